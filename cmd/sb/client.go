@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snippet is a snippet as the API returns it.
+type snippet struct {
+	ID             int       `json:"id"`
+	Title          string    `json:"title"`
+	Content        string    `json:"content"`
+	Visibility     string    `json:"visibility"`
+	OrganizationID int       `json:"organization_id,omitempty"`
+	Created        time.Time `json:"created"`
+	Expires        time.Time `json:"expires"`
+	URL            string    `json:"url"`
+}
+
+// newSnippet is the body of a request creating a snippet.
+type newSnippet struct {
+	Title        string `json:"title"`
+	Content      string `json:"content"`
+	Expires      int    `json:"expires,omitempty"`
+	Visibility   string `json:"visibility,omitempty"`
+	Organization int    `json:"organization,omitempty"`
+}
+
+// apiError is an error answered by the API.
+type apiError struct {
+	Status  int
+	Message string            `json:"error"`
+	Fields  map[string]string `json:"fields"`
+}
+
+func (e *apiError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+
+	fields := make([]string, 0, len(e.Fields))
+	for field, msg := range e.Fields {
+		fields = append(fields, field+": "+msg)
+	}
+	sort.Strings(fields)
+	return e.Message + " (" + strings.Join(fields, "; ") + ")"
+}
+
+// client calls the API of a Snippetbox server with a personal token.
+type client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newClient(cfg *config) *client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &client{
+		server: strings.TrimSuffix(cfg.Server, "/"),
+		token:  cfg.Token,
+		http:   &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}
+}
+
+func (c *client) create(ctx context.Context, s newSnippet) (*snippet, error) {
+	var created snippet
+	err := c.do(ctx, http.MethodPost, "/api/snippets", s, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *client) get(ctx context.Context, id int) (*snippet, error) {
+	var s snippet
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/snippets/%d", id), nil, &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// search returns the user's snippets whose title or content contains query,
+// or all of them when it is empty.
+func (c *client) search(ctx context.Context, query string) ([]snippet, error) {
+	path := "/api/snippets"
+	if query != "" {
+		path += "?q=" + url.QueryEscape(query)
+	}
+
+	var snippets []snippet
+	err := c.do(ctx, http.MethodGet, path, nil, &snippets)
+	if err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+func (c *client) delete(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/snippets/%d", id), nil, nil)
+}
+
+// The do() method sends in as JSON, if not nil, and decodes the response into
+// out, if not nil. Error responses become an *apiError.
+func (c *client) do(ctx context.Context, method, path string, in, out any) error {
+	if c.server == "" || c.token == "" {
+		return fmt.Errorf("no server or token: run sb config -server URL -token TOKEN first")
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		apiErr := &apiError{Status: resp.StatusCode}
+		// Not every error is JSON: the server answers some, such as rate
+		// limiting, in plain text.
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
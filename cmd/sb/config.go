@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// config is what sb remembers between runs: the server to talk to and the
+// personal token to authenticate with.
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+	// Accept the server's certificate without verifying it, for servers
+	// using the self-signed certificate of a development setup.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// The defaultConfigPath() function returns where the config lives unless
+// -config says otherwise: snippetbox/sb.json in the user's config directory.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "sb.json"
+	}
+	return filepath.Join(dir, "snippetbox", "sb.json")
+}
+
+// The loadConfig() function reads the config at path. A missing file is an
+// empty config.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// The save() method writes the config to path, readable by the user alone
+// since it holds their token.
+func (cfg *config) save(path string) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
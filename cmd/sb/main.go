@@ -0,0 +1,241 @@
+// Command sb is a command line client for the API of a Snippetbox server. It
+// authenticates with a personal token, which users generate on their account
+// page.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `usage: sb [-config file] [-server URL] [-token token] [-o text|json] command [args]
+
+commands:
+  config [-server URL] [-token token] [-insecure]  save the server and token, or show them
+  create -t title [-expires days] [-visibility public|organization] [-org id] < file
+  get id                                           print a snippet's content
+  list                                             list your snippets
+  search words...                                  list your snippets containing the words
+  delete id                                        delete one of your snippets
+`
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sb:", err)
+		os.Exit(1)
+	}
+}
+
+// The run() function runs sb with the given arguments, reading snippets to
+// create from stdin and writing its output to stdout.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("sb", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	configPath := fs.String("config", defaultConfigPath(), "Configuration file")
+	server := fs.String("server", "", "URL of the server, overriding the configuration file")
+	token := fs.String("token", "", "Personal token, overriding the configuration file")
+	output := fs.String("o", "text", "Output format: text or json")
+
+	err := fs.Parse(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("-o: must be text or json, not %q", *output)
+	}
+	if fs.NArg() == 0 {
+		return errors.New(usage)
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	command, args := fs.Arg(0), fs.Args()[1:]
+	if command == "config" {
+		return runConfig(cfg, *configPath, args, stdout)
+	}
+
+	if *server != "" {
+		cfg.Server = *server
+	}
+	if *token != "" {
+		cfg.Token = *token
+	}
+	c := newClient(cfg)
+	p := &printer{w: stdout, json: *output == "json"}
+	ctx := context.Background()
+
+	switch command {
+	case "create":
+		s, err := parseCreate(args, stdin)
+		if err != nil {
+			return err
+		}
+		created, err := c.create(ctx, s)
+		if err != nil {
+			return err
+		}
+		return p.snippet(created, created.URL+"\n")
+
+	case "get":
+		id, err := parseID(command, args)
+		if err != nil {
+			return err
+		}
+		s, err := c.get(ctx, id)
+		if err != nil {
+			return err
+		}
+		return p.snippet(s, s.Content)
+
+	case "list", "search":
+		if command == "list" && len(args) != 0 {
+			return errors.New("usage: sb list")
+		}
+		if command == "search" && len(args) == 0 {
+			return errors.New("usage: sb search words...")
+		}
+		snippets, err := c.search(ctx, strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		return p.snippets(snippets)
+
+	case "delete":
+		id, err := parseID(command, args)
+		if err != nil {
+			return err
+		}
+		err = c.delete(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !p.json {
+			fmt.Fprintf(stdout, "deleted snippet #%d\n", id)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown command %q\n%s", command, usage)
+	}
+}
+
+// The runConfig() function implements "sb config": it saves the settings
+// given as flags, or shows the current ones when there are none.
+func runConfig(cfg *config, path string, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("sb config", flag.ContinueOnError)
+	fs.StringVar(&cfg.Server, "server", cfg.Server, "URL of the server, such as https://snippetbox.example.com")
+	fs.StringVar(&cfg.Token, "token", cfg.Token, "Personal token, generated on the server's account page")
+	fs.BoolVar(&cfg.Insecure, "insecure", cfg.Insecure, "Don't verify the server's TLS certificate")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NFlag() == 0 {
+		token := ""
+		if cfg.Token != "" {
+			token = "(set)"
+		}
+		fmt.Fprintf(w, "config:   %s\nserver:   %s\ntoken:    %s\ninsecure: %v\n", path, cfg.Server, token, cfg.Insecure)
+		return nil
+	}
+
+	err = cfg.save(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "saved %s\n", path)
+	return nil
+}
+
+// The parseCreate() function reads the snippet to create: its settings from
+// the arguments, its content from r.
+func parseCreate(args []string, r io.Reader) (newSnippet, error) {
+	var s newSnippet
+	fs := flag.NewFlagSet("sb create", flag.ContinueOnError)
+	fs.StringVar(&s.Title, "t", "", "Title of the snippet")
+	fs.IntVar(&s.Expires, "expires", 365, "Days until the snippet expires: 1, 7 or 365")
+	fs.StringVar(&s.Visibility, "visibility", "public", "Who can see the snippet: public or organization")
+	fs.IntVar(&s.Organization, "org", 0, "ID of the organization to share the snippet with")
+	err := fs.Parse(args)
+	if err != nil {
+		return s, err
+	}
+	if s.Title == "" || fs.NArg() != 0 {
+		return s, errors.New("usage: sb create -t title [-expires days] [-visibility public|organization] [-org id] < file")
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return s, err
+	}
+	if len(content) == 0 {
+		return s, errors.New("create: the snippet's content is read from stdin, which is empty")
+	}
+	s.Content = string(content)
+
+	return s, nil
+}
+
+func parseID(command string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("usage: sb %s id", command)
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%s: %q is not a snippet ID", command, args[0])
+	}
+	return id, nil
+}
+
+// printer writes results as text or, with -o json, as the API's JSON.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// The snippet() method prints s, or text in text mode.
+func (p *printer) snippet(s *snippet, text string) error {
+	if p.json {
+		return p.encode(s)
+	}
+
+	_, err := io.WriteString(p.w, text)
+	return err
+}
+
+// The snippets() method prints a table of snippets in text mode.
+func (p *printer) snippets(snippets []snippet) error {
+	if p.json {
+		return p.encode(snippets)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tVISIBILITY\tEXPIRES")
+	for _, s := range snippets {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.ID, s.Title, s.Visibility, s.Expires.Local().Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) encode(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
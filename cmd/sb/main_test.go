@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAPI returns a server answering like a Snippetbox API holding one
+// snippet, #1, and accepting the token "VALIDTOKEN".
+func newTestAPI(t *testing.T) *httptest.Server {
+	stored := snippet{ID: 1, Title: "An old silent pond", Content: "An old silent pond\n", Visibility: "public", Expires: time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/snippets", func(w http.ResponseWriter, r *http.Request) {
+		snippets := []snippet{}
+		if strings.Contains(stored.Title, r.URL.Query().Get("q")) {
+			snippets = append(snippets, stored)
+		}
+		json.NewEncoder(w).Encode(snippets)
+	})
+	mux.HandleFunc("POST /api/snippets", func(w http.ResponseWriter, r *http.Request) {
+		var s newSnippet
+		json.NewDecoder(r.Body).Decode(&s)
+		if s.Expires != 1 && s.Expires != 7 && s.Expires != 365 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error": "invalid snippet", "fields": {"expires": "This field must equal 1, 7 or 365"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(snippet{ID: 2, Title: s.Title, Content: s.Content, URL: "https://snippetbox.test/snippet/view/2"})
+	})
+	mux.HandleFunc("GET /api/snippets/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(stored)
+	})
+	mux.HandleFunc("DELETE /api/snippets/1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer VALIDTOKEN" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid or expired token"}`))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func TestRun(t *testing.T) {
+	api := newTestAPI(t)
+	defer api.Close()
+
+	configPath := filepath.Join(t.TempDir(), "snippetbox", "sb.json")
+	sb := func(stdin string, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(append([]string{"-config", configPath}, args...), strings.NewReader(stdin), &out)
+		return out.String(), err
+	}
+
+	_, err := sb("", "list")
+	assert.StringContains(t, err.Error(), "run sb config")
+
+	out, err := sb("", "config", "-server", api.URL, "-token", "VALIDTOKEN")
+	assert.Equal(t, err, nil)
+	assert.StringContains(t, out, "saved "+configPath)
+
+	out, err = sb("", "config")
+	assert.Equal(t, err, nil)
+	assert.StringContains(t, out, "token:    (set)")
+
+	t.Run("Create", func(t *testing.T) {
+		out, err := sb("package main\n", "create", "-t", "main.go", "-expires", "7")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, out, "https://snippetbox.test/snippet/view/2\n")
+
+		_, err = sb("package main\n", "create", "-t", "main.go", "-expires", "2")
+		assert.Equal(t, err.Error(), "invalid snippet (expires: This field must equal 1, 7 or 365)")
+
+		_, err = sb("", "create", "-t", "empty")
+		assert.StringContains(t, err.Error(), "stdin, which is empty")
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		out, err := sb("", "get", "1")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, out, "An old silent pond\n")
+
+		out, err = sb("", "-o", "json", "get", "1")
+		assert.Equal(t, err, nil)
+		var s snippet
+		assert.Equal(t, json.Unmarshal([]byte(out), &s), nil)
+		assert.Equal(t, s.Title, "An old silent pond")
+
+		_, err = sb("", "get", "one")
+		assert.Equal(t, err.Error(), `get: "one" is not a snippet ID`)
+	})
+
+	t.Run("List and search", func(t *testing.T) {
+		out, err := sb("", "list")
+		assert.Equal(t, err, nil)
+		assert.StringContains(t, out, "ID  TITLE               VISIBILITY  EXPIRES\n1   An old silent pond  public      2030-01-01")
+
+		out, err = sb("", "search", "wintry")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, out, "ID  TITLE  VISIBILITY  EXPIRES\n")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		out, err := sb("", "delete", "1")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, out, "deleted snippet #1\n")
+	})
+
+	t.Run("Token flag", func(t *testing.T) {
+		_, err := sb("", "-token", "WRONGTOKEN", "list")
+		assert.Equal(t, err.Error(), "invalid or expired token")
+	})
+}
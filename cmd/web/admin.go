@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/alexedwards/scs/v2"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const adminUsage = `usage: web [flags] command [args]
+
+commands:
+  user create -email address -name name [-admin] [-password-stdin]
+  user reset-password -email address [-password-stdin]
+  user promote -email address [-role admin|user]
+  snippets purge
+  export [-o file]
+  import [-i file]`
+
+// adminCommands are the subcommands runAdmin() implements.
+var adminCommands = map[string]bool{"user": true, "snippets": true, "export": true, "import": true}
+
+// The version of the export format.
+const exportVersion = 1
+
+// export is the JSON document written by "export" and read by "import". It
+// holds users, with their password hashes, and their unexpired snippets.
+// Organizations aren't exported, so neither are the snippets shared with one.
+type export struct {
+	Version  int             `json:"version"`
+	Exported time.Time       `json:"exported"`
+	Users    []exportUser    `json:"users"`
+	Snippets []exportSnippet `json:"snippets"`
+}
+
+type exportUser struct {
+	ID                    int       `json:"id"`
+	Name                  string    `json:"name"`
+	Email                 string    `json:"email"`
+	HashedPassword        string    `json:"hashed_password"`
+	Created               time.Time `json:"created"`
+	Role                  string    `json:"role"`
+	Disabled              bool      `json:"disabled"`
+	PasswordResetRequired bool      `json:"password_reset_required"`
+}
+
+type exportSnippet struct {
+	ID      int       `json:"id"`
+	UserID  int       `json:"user_id,omitempty"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// adminModels are the models the admin subcommands work with, and the
+// sessions of the server, to sign users out.
+type adminModels struct {
+	users    *models.UserModel
+	snippets *models.SnippetModel
+	tokens   *models.TokenModel
+	auditLog *models.AuditModel
+	sessions *scs.SessionManager
+}
+
+// The newAdminModels() function returns the admin models of db. Stop the
+// cleanup of the session store with stopCleanup() when done.
+func newAdminModels(db *models.DB, bcryptCost int) *adminModels {
+	sessions := scs.New()
+	sessions.Store = newSessionStore(db)
+
+	return &adminModels{
+		users:    &models.UserModel{DB: db, BcryptCost: bcryptCost},
+		snippets: &models.SnippetModel{DB: db},
+		tokens:   &models.TokenModel{DB: db},
+		auditLog: &models.AuditModel{DB: db},
+		sessions: sessions,
+	}
+}
+
+// The runAdmin() function implements the admin subcommands, which manage
+// users and data through the models rather than the web interface. Passwords
+// are read from stdin, and what was done is written to w. Changes to accounts
+// go in the audit trail, from the address "cli".
+func runAdmin(m *adminModels, args []string, stdin io.Reader, w io.Writer) error {
+	if len(args) == 0 || !adminCommands[args[0]] {
+		return errors.New(adminUsage)
+	}
+
+	ctx := context.Background()
+	users, snippets := m.users, m.snippets
+	command := args[0]
+	if len(args) > 1 && (command == "user" || command == "snippets") {
+		command += " " + args[1]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var email *string
+	if command == "user create" || command == "user reset-password" || command == "user promote" {
+		email = fs.String("email", "", "Email address of the user")
+	}
+
+	switch command {
+	case "user create":
+		name := fs.String("name", "", "Name of the user")
+		admin := fs.Bool("admin", false, "Make the user an administrator")
+		passwordStdin := fs.Bool("password-stdin", false, "Read the password from stdin instead of generating one")
+		if err := parseAdminFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if *email == "" || *name == "" {
+			return errors.New("user create: -email and -name are required")
+		}
+
+		password, generated, err := adminPassword(*passwordStdin, stdin)
+		if err != nil {
+			return err
+		}
+		id, err := users.Insert(ctx, *name, *email, password)
+		if err != nil {
+			return err
+		}
+		if *admin {
+			if err := users.SetRole(ctx, id, models.RoleAdmin); err != nil {
+				return err
+			}
+			if err := m.audit(ctx, id, models.AuditRoleChange, "role "+models.RoleAdmin); err != nil {
+				return err
+			}
+		}
+		if generated {
+			if err := users.RequirePasswordReset(ctx, id); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "created user #%d with the temporary password %s, to be changed at first login\n", id, password)
+		} else {
+			fmt.Fprintf(w, "created user #%d\n", id)
+		}
+		return nil
+
+	case "user reset-password":
+		passwordStdin := fs.Bool("password-stdin", false, "Read the password from stdin instead of generating one")
+		if err := parseAdminFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		user, err := adminUser(ctx, users, *email)
+		if err != nil {
+			return err
+		}
+
+		password, generated, err := adminPassword(*passwordStdin, stdin)
+		if err != nil {
+			return err
+		}
+		if err := users.SetPassword(ctx, user.ID, password); err != nil {
+			return err
+		}
+		// Like changing a password on the web, and for the same reason: sign
+		// out whoever holds a session. Personal tokens would get around the new
+		// password too.
+		_, err = destroySessions(ctx, m.sessions, user.ID, func(string) bool { return true })
+		if err != nil {
+			return err
+		}
+		if err := m.tokens.DeleteAllForUser(ctx, models.ScopeAPI, user.ID); err != nil {
+			return err
+		}
+		if err := m.audit(ctx, user.ID, models.AuditPasswordChange, "reset from the command line"); err != nil {
+			return err
+		}
+		if generated {
+			if err := users.RequirePasswordReset(ctx, user.ID); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "reset the password of %s to the temporary password %s, to be changed at next login\n", user.Email, password)
+		} else {
+			fmt.Fprintf(w, "reset the password of %s\n", user.Email)
+		}
+		return nil
+
+	case "user promote":
+		role := fs.String("role", models.RoleAdmin, "Role to give the user: admin or user")
+		if err := parseAdminFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if *role != models.RoleAdmin && *role != models.RoleUser {
+			return fmt.Errorf("user promote: -role must be admin or user, not %q", *role)
+		}
+		user, err := adminUser(ctx, users, *email)
+		if err != nil {
+			return err
+		}
+		if err := users.SetRole(ctx, user.ID, *role); err != nil {
+			return err
+		}
+		if err := m.audit(ctx, user.ID, models.AuditRoleChange, "role "+*role); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s now has the %s role\n", user.Email, *role)
+		return nil
+
+	case "snippets purge":
+		if err := parseAdminFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		n, err := snippets.DeleteExpired(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "deleted %d expired snippets\n", n)
+		return nil
+
+	case "export":
+		output := fs.String("o", "", "File to write to, instead of stdout")
+		if err := parseAdminFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		out := w
+		if *output != "" {
+			// The export holds password hashes.
+			f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		err := exportData(ctx, users, snippets, out)
+		if err == nil && *output != "" {
+			fmt.Fprintf(w, "exported to %s\n", *output)
+		}
+		return err
+
+	case "import":
+		input := fs.String("i", "", "File to read from, instead of stdin")
+		if err := parseAdminFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		in := stdin
+		if *input != "" {
+			f, err := os.Open(*input)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		return importData(ctx, users, snippets, in, w)
+
+	default:
+		return errors.New(adminUsage)
+	}
+}
+
+// The audit() method records a change a command made to a user's account.
+func (m *adminModels) audit(ctx context.Context, userID int, action, detail string) error {
+	err := m.auditLog.Insert(ctx, &models.AuditEvent{UserID: userID, Action: action, Detail: detail, IP: "cli"})
+	if err != nil {
+		return fmt.Errorf("recording audit event: %w", err)
+	}
+	return nil
+}
+
+func parseAdminFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Name(), err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected argument %q", fs.Name(), fs.Arg(0))
+	}
+	return nil
+}
+
+// The adminUser() function looks up the user with the given email address.
+func adminUser(ctx context.Context, users *models.UserModel, email string) (*models.User, error) {
+	if email == "" {
+		return nil, errors.New("-email is required")
+	}
+
+	user, err := users.GetByEmail(ctx, email)
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil, fmt.Errorf("there is no user with the email address %s", email)
+	}
+	return user, err
+}
+
+// The adminPassword() function reads a password from the first line of stdin
+// or, unless fromStdin is set, generates a random one.
+func adminPassword(fromStdin bool, stdin io.Reader) (password string, generated bool, err error) {
+	if !fromStdin {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			return "", false, err
+		}
+		return strings.ToLower(base32.StdEncoding.EncodeToString(b)), true, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(stdin, 4096))
+	if err != nil {
+		return "", false, err
+	}
+	password, _, _ = strings.Cut(string(data), "\n")
+	password = strings.TrimSuffix(password, "\r")
+	if len(password) < 8 {
+		return "", false, errors.New("the password must be at least 8 characters long")
+	}
+	return password, false, nil
+}
+
+// The exportData() function writes the users and their snippets as JSON.
+func exportData(ctx context.Context, users *models.UserModel, snippets *models.SnippetModel, w io.Writer) error {
+	allUsers, err := users.All(ctx)
+	if err != nil {
+		return err
+	}
+	allSnippets, err := snippets.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	data := export{Version: exportVersion, Exported: time.Now().UTC().Truncate(time.Second)}
+	for _, u := range allUsers {
+		data.Users = append(data.Users, exportUser{
+			ID:                    u.ID,
+			Name:                  u.Name,
+			Email:                 u.Email,
+			HashedPassword:        string(u.HashPassword),
+			Created:               u.Created.UTC(),
+			Role:                  u.Role,
+			Disabled:              u.Disabled,
+			PasswordResetRequired: u.PasswordResetRequired,
+		})
+	}
+	for _, s := range allSnippets {
+		if s.OrganizationID != 0 {
+			continue
+		}
+		data.Snippets = append(data.Snippets, exportSnippet{
+			ID:      s.ID,
+			UserID:  s.UserID,
+			Title:   s.Title,
+			Content: s.Content,
+			Created: s.Created.UTC(),
+			Expires: s.Expires.UTC(),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// The importData() function adds the users and snippets of an export. Users
+// and snippets get new IDs. A user whose email address is already taken is
+// taken to be the same person: their snippets go to the existing account.
+// Snippets already there are skipped, so an import which failed halfway can
+// be run again.
+func importData(ctx context.Context, users *models.UserModel, snippets *models.SnippetModel, r io.Reader, w io.Writer) error {
+	var data export
+	err := json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	if data.Version != exportVersion {
+		return fmt.Errorf("import: unsupported export version %d", data.Version)
+	}
+
+	// New IDs of the users, by their ID in the export.
+	ids := make(map[int]int, len(data.Users))
+	var imported, existing int
+	for _, u := range data.Users {
+		id, err := users.Import(ctx, &models.User{
+			Name:                  u.Name,
+			Email:                 u.Email,
+			HashPassword:          []byte(u.HashedPassword),
+			Created:               u.Created,
+			Role:                  u.Role,
+			Disabled:              u.Disabled,
+			PasswordResetRequired: u.PasswordResetRequired,
+		})
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			user, err := users.GetByEmail(ctx, u.Email)
+			if err != nil {
+				return fmt.Errorf("import: user %s: %w", u.Email, err)
+			}
+			id = user.ID
+			existing++
+		} else if err != nil {
+			return fmt.Errorf("import: user %s: %w", u.Email, err)
+		} else {
+			imported++
+		}
+		ids[u.ID] = id
+	}
+
+	var importedSnippets, existingSnippets int
+	for _, s := range data.Snippets {
+		_, err := snippets.Import(ctx, &models.Snippet{
+			UserID:     ids[s.UserID],
+			Title:      s.Title,
+			Content:    s.Content,
+			Visibility: models.VisibilityPublic,
+			Created:    s.Created,
+			Expires:    s.Expires,
+		})
+		if errors.Is(err, models.ErrDuplicateSnippet) {
+			existingSnippets++
+		} else if err != nil {
+			return fmt.Errorf("import: snippet #%d: %w", s.ID, err)
+		} else {
+			importedSnippets++
+		}
+	}
+
+	fmt.Fprintf(w, "imported %d users (%d already existed) and %d snippets (%d already existed)\n",
+		imported, existing, importedSnippets, existingSnippets)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAdminTestDB returns the models of a new SQLite database with the schema
+// applied.
+func newAdminTestDB(t *testing.T) *adminModels {
+	db, err := openDB(models.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = runMigrate(db, []string{"up"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lowest cost bcrypt allows keeps the tests fast.
+	m := newAdminModels(db, 4)
+	t.Cleanup(func() { stopCleanup(m.sessions.Store) })
+	return m
+}
+
+func TestAdminCommands(t *testing.T) {
+	m := newAdminTestDB(t)
+	users, snippets := m.users, m.snippets
+	ctx := context.Background()
+
+	admin := func(stdin string, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runAdmin(m, args, strings.NewReader(stdin), &out)
+		return out.String(), err
+	}
+
+	out, err := admin("", "user", "create", "-email", "alice@example.com", "-name", "Alice")
+	assert.Equal(t, err, nil)
+	assert.StringContains(t, out, "created user #1 with the temporary password")
+	alice, err := users.GetByEmail(ctx, "alice@example.com")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, alice.PasswordResetRequired, true)
+	assert.Equal(t, alice.Role, models.RoleUser)
+
+	_, err = admin("short\n", "user", "create", "-email", "bob@example.com", "-name", "Bob", "-password-stdin")
+	assert.Equal(t, err.Error(), "the password must be at least 8 characters long")
+
+	token, err := m.tokens.New(ctx, alice.ID, time.Hour, models.ScopeAPI)
+	assert.Equal(t, err, nil)
+	sessionCtx, err := m.sessions.Load(ctx, "")
+	assert.Equal(t, err, nil)
+	m.sessions.Put(sessionCtx, "authenticatedUserID", alice.ID)
+	session, _, err := m.sessions.Commit(sessionCtx)
+	assert.Equal(t, err, nil)
+	out, err = admin("pa$$word\n", "user", "reset-password", "-email", "alice@example.com", "-password-stdin")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, out, "reset the password of alice@example.com\n")
+	id, err := users.Authenticate(ctx, "alice@example.com", "pa$$word")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, id, alice.ID)
+	// The reset revokes the user's personal tokens and sessions, and the
+	// password set for them needn't be changed.
+	_, err = users.GetForToken(ctx, models.ScopeAPI, token.Plaintext)
+	assert.Equal(t, err, models.ErrNoRecord)
+	_, exists, err := m.sessions.Store.Find(session)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, exists, false)
+	alice, _ = users.Get(ctx, alice.ID)
+	assert.Equal(t, alice.PasswordResetRequired, false)
+
+	out, err = admin("", "user", "promote", "-email", "alice@example.com")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, out, "alice@example.com now has the admin role\n")
+	alice, _ = users.Get(ctx, alice.ID)
+	assert.Equal(t, alice.Role, models.RoleAdmin)
+
+	// Both changes are in the user's audit trail.
+	events, err := m.auditLog.Search(ctx, models.AuditFilter{UserID: alice.ID})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(events), 2)
+	assert.Equal(t, events[0].Action, models.AuditRoleChange)
+	assert.Equal(t, events[0].Detail, "role admin")
+	assert.Equal(t, events[1].Action, models.AuditPasswordChange)
+	assert.Equal(t, events[1].IP, "cli")
+
+	_, err = admin("", "user", "promote", "-email", "nobody@example.com")
+	assert.Equal(t, err.Error(), "there is no user with the email address nobody@example.com")
+
+	_, err = admin("", "user", "delete")
+	assert.StringContains(t, err.Error(), "usage: web [flags] command [args]")
+
+	// Expired snippets are purged, the others exported.
+	_, err = snippets.Insert(ctx, alice.ID, 0, "Kept", "An old silent pond", models.VisibilityPublic, 7)
+	assert.Equal(t, err, nil)
+	_, err = snippets.Insert(ctx, alice.ID, 0, "Expired", "Over the wintry forest", models.VisibilityPublic, -1)
+	assert.Equal(t, err, nil)
+
+	out, err = admin("", "snippets", "purge")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, out, "deleted 1 expired snippets\n")
+
+	exported, err := admin("", "export")
+	assert.Equal(t, err, nil)
+	assert.StringContains(t, exported, `"email": "alice@example.com"`)
+	assert.StringContains(t, exported, `"title": "Kept"`)
+
+	// Importing into another database keeps passwords and roles.
+	m = newAdminTestDB(t)
+	users, snippets = m.users, m.snippets
+	out, err = admin(exported, "import")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, out, "imported 1 users (0 already existed) and 1 snippets (0 already existed)\n")
+
+	id, err = users.Authenticate(ctx, "alice@example.com", "pa$$word")
+	assert.Equal(t, err, nil)
+	alice, _ = users.Get(ctx, id)
+	assert.Equal(t, alice.Role, models.RoleAdmin)
+	found, err := snippets.Search(ctx, id, "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(found), 1)
+	assert.Equal(t, found[0].Title, "Kept")
+
+	// Importing again finds the users and snippets already there.
+	out, err = admin(exported, "import")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, out, "imported 0 users (1 already existed) and 0 snippets (1 already existed)\n")
+	found, err = snippets.Search(ctx, id, "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(found), 1)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"github.com/minhnghia2k3/snippet_box/internal/validator"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long personal API tokens are valid for.
+const apiTokenTTL = 365 * 24 * time.Hour
+
+// apiSnippet is a snippet as the API returns it.
+type apiSnippet struct {
+	ID             int       `json:"id"`
+	Title          string    `json:"title"`
+	Content        string    `json:"content"`
+	Visibility     string    `json:"visibility"`
+	OrganizationID int       `json:"organization_id,omitempty"`
+	Created        time.Time `json:"created"`
+	Expires        time.Time `json:"expires"`
+	URL            string    `json:"url"`
+}
+
+func (app *application) newAPISnippet(r *http.Request, s *models.Snippet) apiSnippet {
+	return apiSnippet{
+		ID:             s.ID,
+		Title:          s.Title,
+		Content:        s.Content,
+		Visibility:     s.Visibility,
+		OrganizationID: s.OrganizationID,
+		Created:        s.Created.UTC(),
+		Expires:        s.Expires.UTC(),
+		URL:            app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", s.ID)),
+	}
+}
+
+// Body of POST /api/snippets. Expires is in days, like in the form, and
+// defaults to a year; visibility defaults to public.
+type apiSnippetInput struct {
+	Title               string `json:"title"`
+	Content             string `json:"content"`
+	Expires             int    `json:"expires"`
+	Visibility          string `json:"visibility"`
+	Organization        int    `json:"organization"`
+	validator.Validator `json:"-"`
+}
+
+// The writeJSON() helper sends v as an indented JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// The apiError() helper sends {"error": message}, the API's counterpart of
+// clientError().
+func (app *application) apiError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// The apiServerError() helper logs err like serverError() does, and sends a
+// JSON error.
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r).Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+
+	status := http.StatusInternalServerError
+	var timeoutError *models.QueryTimeoutError
+	if errors.As(err, &timeoutError) {
+		status = http.StatusServiceUnavailable
+	}
+	app.apiError(w, status, http.StatusText(status))
+}
+
+// authenticateToken authenticates API requests with the personal token in
+// their "Authorization: Bearer" header, in place of a session. Requests
+// without a valid token are turned away.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.apiError(w, http.StatusUnauthorized, "a personal token is required")
+			return
+		}
+
+		user, err := app.users.GetForToken(r.Context(), models.ScopeAPI, token)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.apiServerError(w, r, err)
+			return
+		}
+		if err != nil || user.Disabled {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			app.apiError(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+		// Like the web pages, the API waits for a new password.
+		if user.PasswordResetRequired {
+			app.apiError(w, http.StatusForbidden, "a new password must be chosen before using the API")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserContextKey, user)
+		setLoggedUser(ctx, user.ID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GET: /api/snippets?q=pond
+// The user's unexpired snippets, the latest first, optionally only those
+// whose title or content contains q.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Search(r.Context(), app.authenticatedUser(r).ID, r.URL.Query().Get("q"))
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	out := make([]apiSnippet, len(snippets))
+	for i, s := range snippets {
+		out[i] = app.newAPISnippet(r, s)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// POST: /api/snippets
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var input apiSnippetInput
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&input); err != nil {
+		app.apiError(w, http.StatusBadRequest, "the body must be a JSON object: "+err.Error())
+		return
+	}
+	if input.Expires == 0 {
+		input.Expires = 365
+	}
+	if input.Visibility == "" {
+		input.Visibility = models.VisibilityPublic
+	}
+
+	input.CheckField(validator.NotBlank(input.Title), "title", "This field cannot be blank")
+	input.CheckField(validator.MaxChars(input.Title, 100), "title", "This field cannot be longer than 100 characters")
+	input.CheckField(validator.NotBlank(input.Content), "content", "This field cannot be blank")
+	input.CheckField(validator.PermittedValue(input.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	input.CheckField(validator.PermittedValue(input.Visibility, models.VisibilityPublic, models.VisibilityOrganization), "visibility", "This field must be public or organization")
+
+	userID := app.authenticatedUser(r).ID
+	if input.Organization != 0 {
+		_, err := app.organizations.MemberRole(r.Context(), input.Organization, userID)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.apiServerError(w, r, err)
+				return
+			}
+			input.AddFieldError("organization", "You are not a member of this organization")
+		}
+	} else if input.Visibility == models.VisibilityOrganization {
+		input.AddFieldError("organization", "Choose the organization to share this snippet with")
+	}
+
+	if !input.Valid() {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":  "invalid snippet",
+			"fields": input.FieldErrors,
+		})
+		return
+	}
+
+	id, err := app.snippets.Insert(r.Context(), userID, input.Organization, input.Title, input.Content, input.Visibility, input.Expires)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	created := time.Now()
+	snippet := &models.Snippet{
+		ID:             id,
+		UserID:         userID,
+		OrganizationID: input.Organization,
+		Title:          input.Title,
+		Content:        input.Content,
+		Visibility:     input.Visibility,
+		Created:        created,
+		Expires:        created.AddDate(0, 0, input.Expires),
+	}
+	app.audit(r, userID, models.AuditSnippetCreate, fmt.Sprintf("snippet #%d: %s", id, input.Title))
+	app.webhookEvent(r, userID, webhookSnippetCreated, snippet)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/snippets/%d", id))
+	writeJSON(w, http.StatusCreated, app.newAPISnippet(r, snippet))
+}
+
+// GET: /api/snippets/1
+// Any snippet the user may see, not just their own.
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, app.newAPISnippet(r, snippet))
+}
+
+// DELETE: /api/snippets/1
+// Users can delete their own snippets.
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	userID := app.authenticatedUser(r).ID
+	if snippet.UserID != userID {
+		app.apiError(w, http.StatusForbidden, "only the author of a snippet can delete it")
+		return
+	}
+
+	err := app.snippets.Delete(r.Context(), snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "snippet not found")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, userID, models.AuditSnippetDelete, fmt.Sprintf("snippet #%d", snippet.ID))
+	app.webhookEvent(r, userID, webhookSnippetDeleted, snippet)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiSnippet is the API's viewableSnippet(): it loads the snippet named by
+// the "id" parameter, and sends a JSON error unless the user may see it.
+func (app *application) apiSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.apiError(w, http.StatusNotFound, "snippet not found")
+		return nil, false
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "snippet not found")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	ok, err := app.canViewSnippet(r, snippet)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return nil, false
+	}
+	if !ok {
+		app.apiError(w, http.StatusNotFound, "snippet not found")
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// GET: /account/tokens
+// Lets the user generate a personal token for the API, or revoke theirs.
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusOK, "account_tokens.tmpl", app.newTemplateData(r))
+}
+
+// POST: /account/tokens
+// Generates a personal token. Only its hash is stored, so the page showing
+// it is the only chance to copy it.
+func (app *application) accountTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUser(r).ID
+	token, err := app.tokens.New(r.Context(), userID, apiTokenTTL, models.ScopeAPI)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, userID, models.AuditTokenCreate, "expires "+token.Expiry.UTC().Format(time.DateOnly))
+
+	data := app.newTemplateData(r)
+	data.Token = token
+	// Keep the token out of caches, and of the browser's history.
+	w.Header().Set("Cache-Control", "no-store")
+	app.render(w, r, http.StatusOK, "account_tokens.tmpl", data)
+}
+
+// POST: /account/tokens/revoke
+// Revokes every personal token of the user.
+func (app *application) accountTokensRevokePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUser(r).ID
+	err := app.tokens.DeleteAllForUser(r.Context(), models.ScopeAPI, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, userID, models.AuditTokenRevoke, "")
+
+	app.sessionManager.Put(r.Context(), "flash", "Your personal tokens have been revoked.")
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"github.com/minhnghia2k3/snippet_box/internal/models/mocks"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	app := newTestApplication(t)
+	auditLog := app.auditLog.(*mocks.AuditModel)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	auth := http.Header{}
+	auth.Set("Authorization", "Bearer VALIDTOKEN")
+
+	t.Run("Authentication", func(t *testing.T) {
+		code, header, body := ts.request(t, http.MethodGet, "/api/snippets", http.Header{}, "")
+		assert.Equal(t, code, http.StatusUnauthorized)
+		assert.Equal(t, header.Get("WWW-Authenticate"), "Bearer")
+		assert.StringContains(t, body, `"error": "a personal token is required"`)
+
+		wrong := http.Header{}
+		wrong.Set("Authorization", "Bearer WRONGTOKEN")
+		code, _, body = ts.request(t, http.MethodGet, "/api/snippets", wrong, "")
+		assert.Equal(t, code, http.StatusUnauthorized)
+		assert.StringContains(t, body, "invalid or expired token")
+
+		reset := http.Header{}
+		reset.Set("Authorization", "Bearer RESETTOKEN")
+		code, _, body = ts.request(t, http.MethodGet, "/api/snippets", reset, "")
+		assert.Equal(t, code, http.StatusForbidden)
+		assert.StringContains(t, body, `"error": "a new password must be chosen before using the API"`)
+	})
+
+	t.Run("List and search", func(t *testing.T) {
+		code, _, body := ts.request(t, http.MethodGet, "/api/snippets", auth, "")
+		assert.Equal(t, code, http.StatusOK)
+
+		var snippets []apiSnippet
+		err := json.Unmarshal([]byte(body), &snippets)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(snippets), 2)
+
+		code, _, body = ts.request(t, http.MethodGet, "/api/snippets?q=wintry", auth, "")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `"title": "Over the wintry forest"`)
+		assert.StringContains(t, body, `"organization_id": 1`)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		code, _, body := ts.request(t, http.MethodGet, "/api/snippets/1", auth, "")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `"title": "An old silent pond"`)
+		assert.StringContains(t, body, `"url": "https://snippetbox.example.com/snippet/view/1"`)
+
+		code, _, body = ts.request(t, http.MethodGet, "/api/snippets/99", auth, "")
+		assert.Equal(t, code, http.StatusNotFound)
+		assert.StringContains(t, body, "snippet not found")
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		code, header, body := ts.request(t, http.MethodPost, "/api/snippets", auth, `{"title": "From the API", "content": "Hello"}`)
+		assert.Equal(t, code, http.StatusCreated)
+		assert.Equal(t, header.Get("Location"), "/api/snippets/2")
+		assert.StringContains(t, body, `"visibility": "public"`)
+		assert.Equal(t, auditLog.Events[len(auditLog.Events)-1].Action, models.AuditSnippetCreate)
+
+		code, _, body = ts.request(t, http.MethodPost, "/api/snippets", auth, `{"title": "", "content": "Hello", "expires": 2}`)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, `"title": "This field cannot be blank"`)
+		assert.StringContains(t, body, `"expires": "This field must equal 1, 7 or 365"`)
+
+		code, _, _ = ts.request(t, http.MethodPost, "/api/snippets", auth, `{"name": "unknown"}`)
+		assert.Equal(t, code, http.StatusBadRequest)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		code, _, _ := ts.request(t, http.MethodDelete, "/api/snippets/1", auth, "")
+		assert.Equal(t, code, http.StatusNoContent)
+		assert.Equal(t, auditLog.Events[len(auditLog.Events)-1].Action, models.AuditSnippetDelete)
+	})
+}
+
+func TestAccountTokens(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "real@gmail.com")
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	code, header, body := ts.postForm(t, "/account/tokens", form)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Cache-Control"), "no-store")
+	assert.StringContains(t, body, "<pre><code>VALIDTOKEN</code></pre>")
+
+	code, header, _ = ts.postForm(t, "/account/tokens/revoke", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/tokens")
+}
+
+func TestAPITokensRevokedWithPassword(t *testing.T) {
+	t.Run("Password update", func(t *testing.T) {
+		app := newTestApplication(t)
+		tokens := app.tokens.(*mocks.TokenModel)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		form := url.Values{}
+		form.Add("csrf_token", ts.login(t, "real@gmail.com"))
+		form.Add("currentPassword", "pa$$word")
+		form.Add("newPassword", "new-pa$$word")
+		form.Add("confirmPassword", "new-pa$$word")
+		code, _, _ := ts.postForm(t, "/account/password/update", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, len(tokens.Deleted[models.ScopeAPI]), 1)
+		assert.Equal(t, tokens.Deleted[models.ScopeAPI][0], 1)
+	})
+
+	t.Run("Admin reset", func(t *testing.T) {
+		app := newTestApplication(t)
+		tokens := app.tokens.(*mocks.TokenModel)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		form := url.Values{}
+		form.Add("csrf_token", ts.login(t, "admin@gmail.com"))
+		code, _, _ := ts.postForm(t, "/admin/users/1/reset-password", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, len(tokens.Deleted[models.ScopeAPI]), 1)
+		assert.Equal(t, tokens.Deleted[models.ScopeAPI][0], 1)
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/csv"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"github.com/minhnghia2k3/snippet_box/internal/validator"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of events shown on the audit pages. The CSV export has no limit.
+const auditPageSize = 200
+
+// Filter form on the admin audit page. Dates are in YYYY-MM-DD form, and To is
+// inclusive.
+type auditFilterForm struct {
+	User                string
+	Action              string
+	From                string
+	To                  string
+	Actions             []string
+	validator.Validator `form:"-"`
+}
+
+// The audit() method records an event concerning the user with the given ID
+// (0 for none) in the audit log, along with the client's IP and user agent
+// and the authenticated user, when that's someone else. A failure to record
+// the event is logged but doesn't fail the request.
+func (app *application) audit(r *http.Request, userID int, action, detail string) {
+	event := &models.AuditEvent{
+		UserID:    userID,
+		Action:    action,
+		Detail:    detail,
+		IP:        app.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if actor := app.authenticatedUser(r); actor != nil && actor.ID != userID {
+		event.ActorID = actor.ID
+	}
+
+	err := app.auditLog.Insert(r.Context(), event)
+	if err != nil {
+		app.requestLogger(r).Error("recording audit event", "action", action, "user_id", userID, "error", err)
+	}
+}
+
+// GET: /account/security
+// Shows the user their own audit trail.
+func (app *application) accountSecurity(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	events, err := app.auditLog.Search(r.Context(), models.AuditFilter{UserID: id, Limit: auditPageSize})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.AuditEvents = events
+
+	app.render(w, r, http.StatusOK, "account_security.tmpl", data)
+}
+
+// GET: /admin/audit?user=1&action=login.failure&from=2024-01-01&to=2024-01-31
+// Lists the audit events matching the filter, the latest first.
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	filter, form := app.auditFilter(r.URL.Query())
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	if !form.Valid() {
+		app.render(w, r, http.StatusUnprocessableEntity, "admin_audit.tmpl", data)
+		return
+	}
+
+	filter.Limit = auditPageSize
+	events, err := app.auditLog.Search(r.Context(), filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.AuditEvents = events
+
+	app.render(w, r, http.StatusOK, "admin_audit.tmpl", data)
+}
+
+// GET: /admin/audit/export?user=1&action=...
+// Downloads every audit event matching the filter as CSV.
+func (app *application) adminAuditExport(w http.ResponseWriter, r *http.Request) {
+	filter, form := app.auditFilter(r.URL.Query())
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	events, err := app.auditLog.Search(r.Context(), filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "time", "user_id", "user_email", "actor_id", "action", "detail", "ip", "user_agent"})
+	for _, e := range events {
+		cw.Write([]string{
+			strconv.Itoa(e.ID),
+			e.Created.UTC().Format(time.RFC3339),
+			optionalID(e.UserID),
+			csvSafe(e.UserEmail),
+			optionalID(e.ActorID),
+			e.Action,
+			csvSafe(e.Detail),
+			e.IP,
+			csvSafe(e.UserAgent),
+		})
+	}
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		app.requestLogger(r).Error("writing audit export", "error", err)
+	}
+}
+
+// auditFilter reads the audit filter form from query.
+func (app *application) auditFilter(query url.Values) (models.AuditFilter, *auditFilterForm) {
+	form := &auditFilterForm{
+		User:    query.Get("user"),
+		Action:  query.Get("action"),
+		From:    query.Get("from"),
+		To:      query.Get("to"),
+		Actions: models.AuditActions,
+	}
+
+	var filter models.AuditFilter
+	var err error
+	if form.User != "" {
+		filter.UserID, err = strconv.Atoi(form.User)
+		form.CheckField(err == nil && filter.UserID > 0, "user", "This field must be a user ID")
+	}
+	if form.Action != "" {
+		form.CheckField(validator.PermittedValue(form.Action, models.AuditActions...), "action", "This field must be one of the listed actions")
+		filter.Action = form.Action
+	}
+	if form.From != "" {
+		filter.Since, err = time.Parse(time.DateOnly, form.From)
+		form.CheckField(err == nil, "from", "This field must be a date such as 2024-01-31")
+	}
+	if form.To != "" {
+		filter.Until, err = time.Parse(time.DateOnly, form.To)
+		form.CheckField(err == nil, "to", "This field must be a date such as 2024-01-31")
+		filter.Until = filter.Until.AddDate(0, 0, 1)
+	}
+
+	return filter, form
+}
+
+func optionalID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+// csvSafe keeps spreadsheets from running client-supplied values, such as a
+// user agent, as formulas. A leading tab or carriage return starts one too.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-sql-driver/mysql"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+type config struct {
+	addr         string
+	debug        bool
+	autoMigrate  bool
+	staticDir    string
+	dbDriver     string
+	dsn          string
+	queryTimeout time.Duration
+	replicas     struct {
+		dsns   stringList
+		window time.Duration
+	}
+	cache struct {
+		size int
+		ttl  time.Duration
+	}
+	log struct {
+		format string
+		level  string
+	}
+	tracing struct {
+		endpoint    string
+		sampleRatio float64
+	}
+	rateLimits struct {
+		// Where the buckets are kept: "memory" or "database".
+		store  string
+		signup rateLimit
+		write  rateLimit
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	tls struct {
+		certFile string
+		keyFile  string
+	}
+	timeouts struct {
+		read     time.Duration
+		write    time.Duration
+		idle     time.Duration
+		shutdown time.Duration
+		// How long the server reports not ready before it starts shutting down.
+		shutdownDelay time.Duration
+	}
+	// Serve plain HTTP, with TLS terminated by a reverse proxy.
+	plainHTTP      bool
+	trustedProxies stringList
+	secureCookies  bool
+	// Address of a listener redirecting HTTP to HTTPS, if any.
+	redirectAddr string
+	// Let webhooks reach loopback, private and link-local addresses.
+	webhookAllowPrivate bool
+	// Address of the listener serving Prometheus metrics, if any.
+	metricsAddr     string
+	sessionLifetime time.Duration
+	bcryptCost      int
+	// Public URL of the server, which absolute links start with.
+	baseURL string
+
+	// Where the value of each setting came from: "default", "file",
+	// "environment" or "flag".
+	sources map[string]string
+	// Set by -print-config.
+	printConfig bool
+}
+
+// Prefix of the environment variables holding settings. The variable for a
+// setting is its flag name in upper case, with dashes turned into underscores:
+// SNIPPETBOX_DB_DRIVER for -db-driver.
+const envPrefix = "SNIPPETBOX_"
+
+// Flags which only make sense on the command line, and aren't settings.
+var metaFlags = map[string]bool{"config": true, "print-config": true}
+
+// Settings whose values must not be shown by -print-config.
+var secretSettings = map[string]bool{"dsn": true, "db-replica-dsn": true, "smtp-password": true}
+
+// The loadConfig() function defines every setting as a flag on fs, then fills
+// in the config from, in increasing order of precedence: the flag defaults, the
+// file given by -config or SNIPPETBOX_CONFIG, SNIPPETBOX_* environment
+// variables and the command line arguments.
+func loadConfig(fs *flag.FlagSet, args []string, getenv func(string) string) (*config, error) {
+	cfg := &config{sources: make(map[string]string)}
+
+	fs.StringVar(&cfg.addr, "addr", ":4000", "HTTP network address")
+	fs.BoolVar(&cfg.debug, "debug", false, "Application debug mode")
+	fs.StringVar(&cfg.baseURL, "base-url", "", "Public URL of the server, such as https://snippets.example.com, for the links in emails, feeds, webhooks and the API (required unless -debug)")
+	fs.StringVar(&cfg.log.format, "log-format", "text", "Log format (text or json)")
+	fs.StringVar(&cfg.log.level, "log-level", "info", "Minimum level of log messages (debug, info, warn or error)")
+	fs.StringVar(&cfg.tracing.endpoint, "otlp-endpoint", "", "URL of an OTLP/HTTP collector to export traces to, such as http://localhost:4318 (tracing is off when empty)")
+	fs.Float64Var(&cfg.tracing.sampleRatio, "trace-sample-ratio", 1, "Ratio of new traces to sample, from 0 to 1")
+	fs.BoolVar(&cfg.autoMigrate, "auto-migrate", false, "Apply pending schema migrations on startup")
+	fs.StringVar(&cfg.staticDir, "static-dir", "./ui/static", "Path to static address")
+	fs.StringVar(&cfg.dbDriver, "db-driver", models.DriverMySQL, "Database driver (mysql, postgres or sqlite)")
+	fs.StringVar(&cfg.dsn, "dsn", "web:secret@tcp(localhost:3306)/snippetbox?parseTime=true", "Data source name for the database driver (a file path for sqlite)")
+	fs.DurationVar(&cfg.queryTimeout, "db-query-timeout", 3*time.Second, "Maximum duration of a single database query (0 for none)")
+	fs.Var(&cfg.replicas.dsns, "db-replica-dsn", "Data source name of a read replica (may be repeated)")
+	fs.DurationVar(&cfg.replicas.window, "db-replica-window", 5*time.Second, "How long a user's reads stay on the primary after they submit a change")
+	fs.IntVar(&cfg.cache.size, "snippet-cache-size", 1000, "Number of snippets to cache in memory (0 to disable the cache)")
+	fs.DurationVar(&cfg.cache.ttl, "snippet-cache-ttl", time.Minute, "How long cached snippets are served for")
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP host (emails are logged when empty)")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Snippetbox <no-reply@snippetbox.local>", "SMTP sender")
+	fs.StringVar(&cfg.tls.certFile, "tls-cert", "./tls/cert.pem", "TLS certificate file")
+	fs.StringVar(&cfg.tls.keyFile, "tls-key", "./tls/key.pem", "TLS private key file")
+	fs.BoolVar(&cfg.plainHTTP, "plain-http", false, "Serve plain HTTP, for use behind a reverse proxy which terminates TLS")
+	fs.Var(&cfg.trustedProxies, "trusted-proxy", "IP address or CIDR prefix of a reverse proxy whose X-Forwarded-For and X-Forwarded-Proto headers are trusted (may be repeated)")
+	fs.BoolVar(&cfg.secureCookies, "secure-cookies", true, "Only send cookies over HTTPS")
+	fs.StringVar(&cfg.redirectAddr, "redirect-addr", "", "Network address of a listener redirecting HTTP to HTTPS (none when empty)")
+	fs.StringVar(&cfg.metricsAddr, "metrics-addr", "", "Network address of a listener serving Prometheus metrics on /metrics, ideally a private one (none when empty)")
+	fs.DurationVar(&cfg.timeouts.read, "read-timeout", 5*time.Second, "Maximum duration for reading a request")
+	fs.DurationVar(&cfg.timeouts.write, "write-timeout", 10*time.Second, "Maximum duration for writing a response")
+	fs.DurationVar(&cfg.timeouts.idle, "idle-timeout", time.Minute, "How long idle keep-alive connections are kept open")
+	fs.DurationVar(&cfg.timeouts.shutdown, "shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests when shutting down")
+	fs.DurationVar(&cfg.timeouts.shutdownDelay, "shutdown-delay", 0, "How long /readyz fails before the server stops accepting connections on SIGINT or SIGTERM, for load balancers to notice")
+	cfg.rateLimits.signup = rateLimit{requests: 10, per: time.Hour}
+	cfg.rateLimits.write = rateLimit{requests: 30, per: time.Minute}
+	fs.Var(&cfg.rateLimits.signup, "rate-limit-signup", "Rate limit of sign-ups per client IP, such as 10/1h (or off)")
+	fs.Var(&cfg.rateLimits.write, "rate-limit-write", "Rate limit of snippet and organization creation per user, such as 30/1m (or off)")
+	fs.StringVar(&cfg.rateLimits.store, "rate-limit-store", "memory", "Where rate limits are kept: memory, per server, or database, shared by the servers using it")
+	fs.BoolVar(&cfg.webhookAllowPrivate, "webhook-allow-private", false, "Let webhooks be delivered to loopback, private and link-local addresses")
+	fs.DurationVar(&cfg.sessionLifetime, "session-lifetime", 12*time.Hour, "How long a session lasts")
+	fs.IntVar(&cfg.bcryptCost, "bcrypt-cost", 12, "bcrypt cost for hashing passwords")
+
+	configFile := fs.String("config", "", "Configuration file, in TOML (.toml) or YAML (.yaml, .yml) format")
+	fs.BoolVar(&cfg.printConfig, "print-config", false, "Print the effective configuration, with secrets redacted, and exit")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		cfg.sources[f.Name] = "default"
+	})
+	fs.Visit(func(f *flag.Flag) {
+		cfg.sources[f.Name] = "flag"
+	})
+
+	// set applies a value from a lower layer than the command line, which
+	// always wins.
+	set := func(name, source string, values ...string) error {
+		if cfg.sources[name] == "flag" {
+			return nil
+		}
+		// A list replaces the default rather than adding to it.
+		if list, ok := fs.Lookup(name).Value.(*stringList); ok {
+			*list = nil
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("%s: invalid value %q for %s: %w", source, value, name, err)
+			}
+		}
+		cfg.sources[name] = source
+		return nil
+	}
+
+	if *configFile == "" {
+		*configFile = getenv(envPrefix + "CONFIG")
+	}
+	if *configFile != "" {
+		settings, err := readConfigFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, values := range settings {
+			if fs.Lookup(name) == nil || metaFlags[name] {
+				return nil, fmt.Errorf("%s: unknown setting %q", *configFile, name)
+			}
+			if err := set(name, "file", values...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		value := getenv(envName(f.Name))
+		if metaFlags[f.Name] || value == "" || envErr != nil {
+			return
+		}
+
+		values := []string{value}
+		if _, ok := f.Value.(*stringList); ok {
+			// Lists are separated by commas in the environment.
+			values = strings.Split(value, ",")
+		}
+		envErr = set(f.Name, "environment", values...)
+	})
+	if envErr != nil {
+		return nil, envErr
+	}
+
+	return cfg, nil
+}
+
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// The readConfigFile() function reads the settings in a configuration file,
+// keyed by flag name. Tables (TOML) and mappings (YAML) are flattened by
+// joining their keys with dashes, so
+//
+//	[smtp]
+//	host = "mail.example.com"
+//
+// sets -smtp-host. Each setting can have several values, for lists.
+func readConfigFile(path string) (map[string][]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	default:
+		return nil, fmt.Errorf("%s: unsupported configuration format, use .toml, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	settings := make(map[string][]string)
+	flattenSettings(settings, "", raw)
+	return settings, nil
+}
+
+func flattenSettings(settings map[string][]string, prefix string, raw map[string]any) {
+	for key, value := range raw {
+		name := prefix + key
+		switch v := value.(type) {
+		case map[string]any:
+			flattenSettings(settings, name+"-", v)
+		case []any:
+			for _, item := range v {
+				settings[name] = append(settings[name], fmt.Sprint(item))
+			}
+		default:
+			settings[name] = []string{fmt.Sprint(v)}
+		}
+	}
+}
+
+// The validate() method checks the settings make sense together, reporting
+// every problem at once.
+func (cfg *config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.log.format == "text" || cfg.log.format == "json", "log-format: must be text or json, not %q", cfg.log.format)
+	var level slog.Level
+	check(level.UnmarshalText([]byte(cfg.log.level)) == nil, "log-level: must be debug, info, warn or error, not %q", cfg.log.level)
+
+	if cfg.tracing.endpoint != "" {
+		u, err := url.Parse(cfg.tracing.endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"otlp-endpoint: %q is not an http or https URL", cfg.tracing.endpoint)
+	}
+	check(cfg.tracing.sampleRatio >= 0 && cfg.tracing.sampleRatio <= 1, "trace-sample-ratio: must be between 0 and 1")
+
+	_, _, err := net.SplitHostPort(cfg.addr)
+	check(err == nil, "addr: %q is not a host:port address", cfg.addr)
+	if cfg.baseURL != "" {
+		u, err := url.Parse(cfg.baseURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil && u.RawQuery == "" && u.Fragment == "",
+			"base-url: %q is not an http or https URL without a query", cfg.baseURL)
+	}
+
+	switch cfg.dbDriver {
+	case models.DriverMySQL, models.DriverPostgres, models.DriverSQLite:
+	default:
+		check(false, "db-driver: must be %s, %s or %s, not %q", models.DriverMySQL, models.DriverPostgres, models.DriverSQLite, cfg.dbDriver)
+	}
+	check(cfg.dsn != "", "dsn: must be set")
+	check(cfg.queryTimeout >= 0, "db-query-timeout: must not be negative")
+	check(cfg.replicas.window >= 0, "db-replica-window: must not be negative")
+
+	check(cfg.cache.size >= 0, "snippet-cache-size: must not be negative")
+	check(cfg.cache.size == 0 || cfg.cache.ttl > 0, "snippet-cache-ttl: must be positive when the cache is enabled")
+
+	check(cfg.rateLimits.store == "memory" || cfg.rateLimits.store == "database", "rate-limit-store: must be memory or database, not %q", cfg.rateLimits.store)
+
+	check(cfg.smtp.port > 0 && cfg.smtp.port < 65536, "smtp-port: %d is not a valid port", cfg.smtp.port)
+
+	check(cfg.plainHTTP || cfg.tls.certFile != "", "tls-cert: must be set")
+	check(cfg.plainHTTP || cfg.tls.keyFile != "", "tls-key: must be set")
+	_, err = parseTrustedProxies(cfg.trustedProxies)
+	check(err == nil, "trusted-proxy: %v", err)
+	if cfg.redirectAddr != "" {
+		_, _, err := net.SplitHostPort(cfg.redirectAddr)
+		check(err == nil, "redirect-addr: %q is not a host:port address", cfg.redirectAddr)
+		check(!cfg.plainHTTP, "redirect-addr: can't redirect to HTTPS with plain-http")
+		check(cfg.redirectAddr != cfg.addr, "redirect-addr: must differ from addr")
+	}
+	if cfg.metricsAddr != "" {
+		_, _, err := net.SplitHostPort(cfg.metricsAddr)
+		check(err == nil, "metrics-addr: %q is not a host:port address", cfg.metricsAddr)
+		check(cfg.metricsAddr != cfg.addr && cfg.metricsAddr != cfg.redirectAddr, "metrics-addr: must differ from addr and redirect-addr")
+	}
+
+	check(cfg.timeouts.read > 0, "read-timeout: must be positive")
+	check(cfg.timeouts.write > 0, "write-timeout: must be positive")
+	check(cfg.timeouts.idle > 0, "idle-timeout: must be positive")
+	check(cfg.timeouts.shutdown > 0, "shutdown-timeout: must be positive")
+	check(cfg.timeouts.shutdownDelay >= 0, "shutdown-delay: must not be negative")
+	check(cfg.sessionLifetime > 0, "session-lifetime: must be positive")
+
+	check(cfg.bcryptCost >= bcrypt.MinCost && cfg.bcryptCost <= bcrypt.MaxCost,
+		"bcrypt-cost: must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+
+	return errors.Join(errs...)
+}
+
+// The print() method writes the effective settings to w as TOML, which can be
+// used as a configuration file, noting where each value came from. Secrets are
+// redacted.
+func (cfg *config) print(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if metaFlags[f.Name] {
+			return
+		}
+
+		var value string
+		switch v := f.Value.(flag.Getter).Get().(type) {
+		case bool, int, float64:
+			value = fmt.Sprint(v)
+		case []string:
+			quoted := make([]string, len(v))
+			for i, s := range v {
+				quoted[i] = strconv.Quote(redact(f.Name, s))
+			}
+			value = "[" + strings.Join(quoted, ", ") + "]"
+		default:
+			value = strconv.Quote(redact(f.Name, f.Value.String()))
+		}
+
+		fmt.Fprintf(w, "%s = %s # %s\n", f.Name, value, cfg.sources[f.Name])
+	})
+}
+
+// Match the password in a MySQL DSN the driver can't parse, up to the last
+// "@" since the password may contain some, and in a PostgreSQL keyword/value
+// DSN or URL parameter, password=secret.
+var (
+	mysqlPasswordRx   = regexp.MustCompile(`^([^:@/]*):.*@`)
+	keywordPasswordRx = regexp.MustCompile(`(password=)[^\s&]*`)
+)
+
+// The redact() function hides the secret parts of a setting's value. Passwords
+// in DSNs are replaced, leaving the rest for troubleshooting.
+func redact(name, value string) string {
+	if !secretSettings[name] || value == "" {
+		return value
+	}
+
+	if !strings.HasSuffix(name, "dsn") {
+		return "xxxxx"
+	}
+
+	value = keywordPasswordRx.ReplaceAllString(value, "${1}xxxxx")
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+	if c, err := mysql.ParseDSN(value); err == nil {
+		if c.Passwd != "" {
+			c.Passwd = "xxxxx"
+		}
+		return c.FormatDSN()
+	}
+	return mysqlPasswordRx.ReplaceAllString(value, "$1:xxxxx@")
+}
+
+// stringList is a flag which may be given several times, collecting each value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (l *stringList) Get() any {
+	return []string(*l)
+}
@@ -3,3 +3,12 @@ package main
 type contextKey string
 
 var isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// Holds the *models.User of the authenticated user.
+var authenticatedUserContextKey = contextKey("authenticatedUser")
+
+// Holds the ID of the request, as a string.
+var requestIDContextKey = contextKey("requestID")
+
+// Holds the *requestLog which logRequest fills in.
+var requestLogContextKey = contextKey("requestLog")
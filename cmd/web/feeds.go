@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Atom feed documents, as defined by RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// GET: /feed.atom
+// The latest public snippets, as an Atom feed.
+func (app *application) latestFeed(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Latest(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.serveFeed(w, r, "Latest snippets", "Snippetbox", snippets, time.Unix(0, 0))
+}
+
+// GET: /users/123/feed.atom
+// The latest public snippets of a user, as an Atom feed. The route can't live
+// under /user/, whose static routes such as /user/login rule out a parameter
+// next to them: /user/123/feed.atom is redirected here instead.
+func (app *application) userFeed(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	snippets, err := app.snippets.ForUser(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.serveFeed(w, r, "Snippets by "+user.Name, user.Name, snippets, user.Created)
+}
+
+// The redirectUserFeed() function redirects /user/123/feed.atom, the path the
+// per-user feed was asked for under, to /users/123/feed.atom. The router can't
+// route it, so this is done for requests it found no route for, and reports
+// whether r was redirected.
+func redirectUserFeed(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.Path, "/user/")
+	if !ok {
+		return false
+	}
+	id, ok := strings.CutSuffix(rest, "/feed.atom")
+	if n, err := strconv.Atoi(id); !ok || err != nil || n < 1 {
+		return false
+	}
+
+	http.Redirect(w, r, "/users/"+id+"/feed.atom", http.StatusMovedPermanently)
+	return true
+}
+
+// serveFeed writes snippets as an Atom feed with the given title and author.
+// Feeds are the same for everyone, so shared caches may keep them until the
+// first snippet in them expires. An empty feed was last updated at since,
+// which must not change between requests for the feed to be revalidated.
+func (app *application) serveFeed(w http.ResponseWriter, r *http.Request, title, author string, snippets []*models.Snippet, since time.Time) {
+	self := app.absoluteURL(r, r.URL.Path)
+	feed := atomFeed{
+		ID:     self,
+		Title:  title,
+		Author: &atomAuthor{Name: author},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: app.absoluteURL(r, "/")},
+		},
+	}
+
+	var updated time.Time
+	expires := time.Now().Add(snippetMaxAge)
+	for _, s := range snippets {
+		link := app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", s.ID))
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      link,
+			Title:   s.Title,
+			Updated: s.Created.UTC().Format(time.RFC3339),
+			Link:    atomLink{Rel: "alternate", Type: "text/html", Href: link},
+			Content: atomContent{Type: "text", Body: s.Content},
+		})
+		if s.Created.After(updated) {
+			updated = s.Created
+		}
+		if s.Expires.Before(expires) {
+			expires = s.Expires
+		}
+	}
+	if updated.IsZero() {
+		updated = since.Truncate(time.Second)
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	serveCacheable(w, r, append([]byte(xml.Header), body...), updated, expires, "public")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
@@ -8,13 +9,21 @@ import (
 	"github.com/minhnghia2k3/snippet_box/internal/validator"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// Owners are emailed after this many failed login attempts in a row, and
+// again after every further multiple.
+const notifyLoginFailuresEvery = 5
+
 // represent the form data and validation errors for the form field.
 type snippetCreateForm struct {
 	Title               string     `form:"title"`
 	Content             string     `form:"content"`
 	Expires             int        `form:"expires"`
+	Organization        int        `form:"organization"`
+	Visibility          string     `form:"visibility"`
 	validator.Validator `form:"-"` // Embedded type
 }
 
@@ -33,6 +42,27 @@ type userLoginForm struct {
 	validator.Validator `form:"-"`
 }
 
+// Form for editing the user's profile
+type accountProfileForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+// Form for deleting the user's account. Snippets is either "delete" or
+// "anonymise".
+type accountDeleteForm struct {
+	Password            string `form:"password"`
+	Snippets            string `form:"snippets"`
+	validator.Validator `form:"-"`
+}
+
+// Form identifying one of the user's sessions
+type sessionRevokeForm struct {
+	ID                  string `form:"id"`
+	validator.Validator `form:"-"`
+}
+
 // Create new Update User Password form
 type updateUserPassword struct {
 	CurrentPassword     string `form:"currentPassword"`
@@ -43,9 +73,9 @@ type updateUserPassword struct {
 
 // home() render `home.tmpl` with template data.
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest()
+	snippets, err := app.snippets.Latest(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -53,44 +83,105 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
 
-	app.render(w, http.StatusOK, "home.tmpl", data)
+	app.render(w, r, http.StatusOK, "home.tmpl", data)
 }
 
 // GET: /snippet/view/123
 // Validate `id` param
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	// Only the page a visitor sees is the same on every request: signed in
+	// users get a fresh CSRF token in it each time.
+	if snippet.Visibility != models.VisibilityPublic || app.isAuthenticated(r) {
+		app.render(w, r, http.StatusOK, "view.tmpl", data)
+		return
+	}
+
+	buf, err := app.renderPage(r.Context(), "view.tmpl", data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	serveCacheable(w, r, buf.Bytes(), snippet.Created, snippet.Expires, "private")
+}
+
+// GET: /snippet/raw/123
+// Serves the content of the snippet alone, as plain text.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.viewableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	scope := "public"
+	if snippet.Visibility != models.VisibilityPublic {
+		scope = "private"
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	serveCacheable(w, r, []byte(snippet.Content), snippet.Created, snippet.Expires, scope)
+}
+
+// viewableSnippet loads the snippet named by the "id" parameter. If it doesn't
+// exist or the user may not see it, an error response is sent and ok is false.
+func (app *application) viewableSnippet(w http.ResponseWriter, r *http.Request) (snippet *models.Snippet, ok bool) {
 	params := httprouter.ParamsFromContext(r.Context())
 
 	// Convert id string to an integer
 	id, err := strconv.Atoi(params.ByName("id"))
 	if err != nil || id < 1 {
 		app.notFound(w)
-		return
+		return nil, false
 	}
 
-	snippet, err := app.snippets.Get(id)
+	snippet, err = app.snippets.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
-		return
+		return nil, false
 	}
 
-	data := app.newTemplateData(r)
-	data.Snippet = snippet
+	// Snippets the user isn't allowed to see don't exist, as far as they know.
+	ok, err = app.canViewSnippet(r, snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+	if !ok {
+		app.notFound(w)
+		return nil, false
+	}
 
-	app.render(w, http.StatusOK, "view.tmpl", data)
+	return snippet, true
 }
 
 // Handler to show snippet form
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	organizations, err := app.organizations.ForUser(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	data := app.newTemplateData(r)
+	data.Organizations = organizations
 	data.Form = &snippetCreateForm{
-		Expires: 365,
+		Expires:    365,
+		Visibility: models.VisibilityPublic,
 	}
-	app.render(w, http.StatusOK, "create.tmpl", data)
+	app.render(w, r, http.StatusOK, "create.tmpl", data)
 }
 
 // Handler to create a new record of snippet to database
@@ -116,22 +207,59 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be longer than 100 characters")
 	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
 	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.VisibilityPublic, models.VisibilityOrganization), "visibility", "This field must be public or organization")
+
+	// Snippets can only be shared with organizations the user belongs to.
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if form.Organization != 0 {
+		_, err := app.organizations.MemberRole(r.Context(), form.Organization, userID)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+			form.AddFieldError("organization", "You are not a member of this organization")
+		}
+	} else if form.Visibility == models.VisibilityOrganization {
+		form.AddFieldError("organization", "Choose the organization to share this snippet with")
+	}
 
 	// If there is any error, redisplay the template.
 	if !form.Valid() {
+		organizations, err := app.organizations.ForUser(r.Context(), userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
 		data := app.newTemplateData(r)
+		data.Organizations = organizations
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
 		return
 	}
 
 	// Insert snippet data to mysql db
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	id, err := app.snippets.Insert(r.Context(), userID, form.Organization, form.Title, form.Content, form.Visibility, form.Expires)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
+	app.audit(r, userID, models.AuditSnippetCreate, fmt.Sprintf("snippet #%d: %s", id, form.Title))
+
+	created := time.Now()
+	app.webhookEvent(r, userID, webhookSnippetCreated, &models.Snippet{
+		ID:             id,
+		UserID:         userID,
+		OrganizationID: form.Organization,
+		Title:          form.Title,
+		Content:        form.Content,
+		Visibility:     form.Visibility,
+		Created:        created,
+		Expires:        created.AddDate(0, 0, form.Expires),
+	})
+
 	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
 
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
@@ -140,7 +268,7 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = &userSignUpForm{}
-	app.render(w, http.StatusOK, "signup.tmpl", data)
+	app.render(w, r, http.StatusOK, "signup.tmpl", data)
 }
 
 func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
@@ -162,26 +290,28 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
 		return
 	}
 
 	// Insert new user data to db.
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	userID, err := app.users.Insert(r.Context(), form.Name, form.Email, form.Password)
 	if err != nil {
 		// Check duplicate email
 		if errors.Is(err, models.ErrDuplicateEmail) {
 			form.AddFieldError("email", "Email address is already is use")
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
 			return
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
+	app.audit(r, userID, models.AuditSignup, "")
+
 	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
@@ -190,7 +320,7 @@ func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = &userLoginForm{}
 
-	app.render(w, http.StatusOK, "login.tmpl", data)
+	app.render(w, r, http.StatusOK, "login.tmpl", data)
 }
 
 func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
@@ -199,6 +329,7 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
+		return
 	}
 
 	// Validate user data
@@ -208,33 +339,74 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
 		return
 	}
+	// Refuse to check the password at all while the account or the client IP
+	// is locked out, so brute forcing can't keep bcrypt busy.
+	accountKey := strings.ToLower(form.Email)
+	ip := app.clientIP(r)
+	lockout := max(app.accountThrottle.lockedFor(accountKey), app.ipThrottle.lockedFor(ip))
+	if lockout > 0 {
+		retryAfter := lockout.Round(time.Second)
+		form.AddNonFieldError(fmt.Sprintf("Too many failed login attempts. Please try again in %s.", retryAfter))
+
+		app.metrics.login("throttled")
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "login.tmpl", data)
+		return
+	}
+
 	// Call Authenticate() method
-	userId, err := app.users.Authenticate(form.Email, form.Password)
+	userId, err := app.users.Authenticate(r.Context(), form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.metrics.login("failure")
+			app.auditLoginFailure(r, form.Email, "incorrect email or password")
+			app.ipThrottle.fail(ip)
+			failures := app.accountThrottle.fail(accountKey)
+			if failures%notifyLoginFailuresEvery == 0 {
+				app.notifyLoginFailures(r.Context(), form.Email, ip, failures)
+			}
+
 			form.AddNonFieldError("Email or password is incorrect")
 
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			app.metrics.login("disabled")
+			app.auditLoginFailure(r, form.Email, "account disabled")
+			form.AddNonFieldError("This account has been disabled")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusForbidden, "login.tmpl", data)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
+	app.accountThrottle.reset(accountKey)
+	app.metrics.login("success")
+	app.audit(r, userId, models.AuditLoginSuccess, "")
 
 	// If valid add id to their session data.
 	// RenewToken() method update session data
 	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 	// Add the ID to the current session
 	app.sessionManager.Put(r.Context(), "authenticatedUserID", userId)
+	err = app.startSession(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	// Get the `key` and delete it from session data
 	path := app.sessionManager.PopString(r.Context(), "redirect_path")
@@ -245,14 +417,55 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
 }
 
+// auditLoginFailure records a failed login attempt with the given email, in the
+// audit trail of its account if there is one.
+func (app *application) auditLoginFailure(r *http.Request, email, reason string) {
+	var userID int
+	user, err := app.users.GetByEmail(r.Context(), email)
+	if err == nil {
+		userID = user.ID
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.requestLogger(r).Error(err.Error())
+	}
+
+	app.audit(r, userID, models.AuditLoginFailure, fmt.Sprintf("%s (%s)", reason, email))
+}
+
+// notifyLoginFailures emails the owner of the account, if there is one, about
+// a run of failed login attempts. The email is sent in the background.
+func (app *application) notifyLoginFailures(ctx context.Context, email, ip string, failures int) {
+	user, err := app.users.GetByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.logger.Error(err.Error(), "request_id", requestIDFrom(ctx))
+		}
+		return
+	}
+
+	data := map[string]any{
+		"Name":     user.Name,
+		"Failures": failures,
+		"IP":       ip,
+		"Time":     humanDate(time.Now()),
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "login_failures.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error(), "request_id", requestIDFrom(ctx))
+		}
+	})
+}
+
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 	// Renew token and remove authenticatedUserId value from session
 	err := app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	id := app.sessionManager.PopInt(r.Context(), "authenticatedUserID")
+	app.audit(r, id, models.AuditLogout, "")
 	// Add Flash message to the session data
 	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
 
@@ -265,7 +478,7 @@ func ping(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) about(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-	app.render(w, http.StatusOK, "about.tmpl", data)
+	app.render(w, r, http.StatusOK, "about.tmpl", data)
 }
 
 func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
@@ -273,25 +486,25 @@ func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
 	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
 	// get user from id
-	user, err := app.users.Get(id)
+	user, err := app.users.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 			return
 		}
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 	data.User = user
 
-	app.render(w, http.StatusOK, "account_view.tmpl", data)
+	app.render(w, r, http.StatusOK, "account_view.tmpl", data)
 }
 
 func (app *application) updatePassword(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = &updateUserPassword{}
 
-	app.render(w, http.StatusOK, "password.tmpl", data)
+	app.render(w, r, http.StatusOK, "password.tmpl", data)
 }
 
 func (app *application) updatePasswordPost(w http.ResponseWriter, r *http.Request) {
@@ -310,24 +523,308 @@ func (app *application) updatePasswordPost(w http.ResponseWriter, r *http.Reques
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "password.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "password.tmpl", data)
 		return
 	}
 	// If valid, call models.User.ChangePassword
 	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
-	err = app.users.PasswordUpdate(id, form.CurrentPassword, form.NewPassword)
+	err = app.users.PasswordUpdate(r.Context(), id, form.CurrentPassword, form.NewPassword)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
 			form.AddFieldError("currentPassword", "Current password is incorrect")
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "password.tmpl", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "password.tmpl", data)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
+
+	// A changed password should lock out anyone else holding a session, and the
+	// current session gets a fresh token too.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	_, err = app.destroyOtherSessions(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.tokens.DeleteAllForUser(r.Context(), models.ScopeAPI, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, id, models.AuditPasswordChange, "")
+
 	app.sessionManager.Put(r.Context(), "flash", "Your password has been updated!")
 
 	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
 }
+
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessions, err := app.userSessions(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+
+	app.render(w, r, http.StatusOK, "sessions.tmpl", data)
+}
+
+// Signs out a single other session of the current user.
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	var form sessionRevokeForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The current session is ended by logging out instead.
+	currentID := app.sessionManager.GetString(r.Context(), "sessionID")
+	if !validator.NotBlank(form.ID) || form.ID == currentID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	destroyed, err := app.destroyUserSessions(r.Context(), id, func(sessionID string) bool {
+		return sessionID == form.ID
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if destroyed == 0 {
+		app.notFound(w)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The session has been signed out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// Signs out every session of the current user except this one.
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	destroyed, err := app.destroyOtherSessions(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Signed out of %d other session(s).", destroyed))
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+func (app *application) accountProfileUpdate(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.Form = &accountProfileForm{
+		Name:  user.Name,
+		Email: user.Email,
+	}
+
+	app.render(w, r, http.StatusOK, "profile.tmpl", data)
+}
+
+// Saves the new name straight away. A new email address only replaces the old
+// one after it has been confirmed through the link sent to it.
+func (app *application) accountProfileUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountProfileForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 255), "name", "This field cannot be longer than 255 characters")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRx), "email", "This field must be a valid email address")
+
+	emailChanged := !strings.EqualFold(form.Email, user.Email)
+	if form.Valid() && emailChanged {
+		_, err := app.users.GetByEmail(r.Context(), form.Email)
+		if err == nil {
+			form.AddFieldError("email", "Email address is already in use")
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.User = user
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "profile.tmpl", data)
+		return
+	}
+
+	if form.Name != user.Name {
+		err = app.users.UpdateName(r.Context(), id, form.Name)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	flash := "Your profile has been updated."
+	if emailChanged {
+		err = app.requestEmailChange(r, user, form.Email)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		flash = fmt.Sprintf("Your profile has been updated. Follow the link we sent to %s to confirm your new email address.", form.Email)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// requestEmailChange stores email as the user's pending address and sends a
+// confirmation link to it. Any earlier confirmation links stop working.
+func (app *application) requestEmailChange(r *http.Request, user *models.User, email string) error {
+	err := app.users.SetPendingEmail(r.Context(), user.ID, email)
+	if err != nil {
+		return err
+	}
+
+	err = app.tokens.DeleteAllForUser(r.Context(), models.ScopeEmailChange, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.tokens.New(r.Context(), user.ID, 24*time.Hour, models.ScopeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]any{
+		"Name": user.Name,
+		"URL":  app.absoluteURL(r, "/account/email/confirm/"+token.Plaintext),
+	}
+
+	app.background(func() {
+		err := app.mailer.Send(email, "email_change.tmpl", data)
+		if err != nil {
+			app.requestLogger(r).Error(err.Error())
+		}
+	})
+
+	return nil
+}
+
+// GET /account/email/confirm/:token
+// The token in the link sent by requestEmailChange() identifies the user, so
+// this works without being logged in.
+func (app *application) accountEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	err := app.users.ConfirmEmail(r.Context(), params.ByName("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.sessionManager.Put(r.Context(), "flash", "This confirmation link is invalid or has expired.")
+		case errors.Is(err, models.ErrDuplicateEmail):
+			app.sessionManager.Put(r.Context(), "flash", "That email address is already in use by another account.")
+		default:
+			app.serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been confirmed!")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountDelete(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = &accountDeleteForm{
+		Snippets: "anonymise",
+	}
+
+	app.render(w, r, http.StatusOK, "account_delete.tmpl", data)
+}
+
+func (app *application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form accountDeleteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.PermittedValue(form.Snippets, "delete", "anonymise"), "snippets", "Choose what happens to your snippets")
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_delete.tmpl", data)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	err = app.users.Delete(r.Context(), id, form.Password, form.Snippets == "delete")
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("password", "Password is incorrect")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "account_delete.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	// The user's snippets were deleted or anonymised without the cache knowing.
+	if app.snippetCache != nil {
+		app.snippetCache.Invalidate()
+	}
+
+	// Sign the user out everywhere, including here.
+	_, err = app.destroyUserSessions(r.Context(), id, func(string) bool { return true })
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// Search form on the admin users page
+type adminUserSearchForm struct {
+	Query string
+}
+
+// GET: /admin?q=bob
+// Lists users, optionally filtered by name or email.
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	users, err := app.users.Search(r.Context(), query)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Users = users
+	data.Form = &adminUserSearchForm{Query: query}
+
+	app.render(w, r, http.StatusOK, "admin_users.tmpl", data)
+}
+
+func (app *application) adminUserDisablePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetUserDisabled(w, r, true)
+}
+
+func (app *application) adminUserEnablePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetUserDisabled(w, r, false)
+}
+
+// Disabling a user also signs them out everywhere.
+func (app *application) adminSetUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Admins can't lock themselves out by accident.
+	if user.ID == app.authenticatedUser(r).ID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err := app.users.SetDisabled(r.Context(), user.ID, disabled)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	flash := fmt.Sprintf("%s has been enabled.", user.Email)
+	if disabled {
+		_, err = app.destroyUserSessions(r.Context(), user.ID, func(string) bool { return true })
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		flash = fmt.Sprintf("%s has been disabled.", user.Email)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *application) adminUserResetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.users.RequirePasswordReset(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	// Personal tokens would still get around the new password.
+	err = app.tokens.DeleteAllForUser(r.Context(), models.ScopeAPI, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s must choose a new password on their next visit.", user.Email))
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// Deletes any snippet, whoever wrote it.
+func (app *application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// The deletion goes in the audit trail of the snippet's author, and to
+	// their webhooks, when it hasn't expired.
+	var authorID int
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err == nil {
+		authorID = snippet.UserID
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.snippets.Delete(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, authorID, models.AuditSnippetDelete, fmt.Sprintf("snippet #%d", id))
+	if snippet != nil {
+		app.webhookEvent(r, authorID, webhookSnippetDeleted, snippet)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d has been deleted.", id))
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// adminTargetUser looks up the user named by the :id route parameter. If it
+// returns false a response has already been sent.
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil, false
+	}
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"github.com/minhnghia2k3/snippet_box/internal/validator"
+	"net/http"
+	"strconv"
+)
+
+// Form for creating an organization
+type orgCreateForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+// Form for adding a member to an organization
+type orgMemberAddForm struct {
+	Email               string `form:"email"`
+	Role                string `form:"role"`
+	validator.Validator `form:"-"`
+}
+
+// Form for removing a member from an organization
+type orgMemberRemoveForm struct {
+	UserID              int `form:"user_id"`
+	validator.Validator `form:"-"`
+}
+
+// GET: /org
+// Lists the organizations the user belongs to.
+func (app *application) orgList(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	organizations, err := app.organizations.ForUser(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Organizations = organizations
+
+	app.render(w, r, http.StatusOK, "orgs.tmpl", data)
+}
+
+func (app *application) orgCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = &orgCreateForm{}
+
+	app.render(w, r, http.StatusOK, "org_create.tmpl", data)
+}
+
+// The user creating an organization becomes its owner.
+func (app *application) orgCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form orgCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be longer than 100 characters")
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "org_create.tmpl", data)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	id, err := app.organizations.Insert(r.Context(), form.Name, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Organization successfully created!")
+	http.Redirect(w, r, fmt.Sprintf("/org/view/%d", id), http.StatusSeeOther)
+}
+
+// GET: /org/view/1
+// Shows the organization's snippets and members, to members only.
+func (app *application) orgView(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.orgMembership(w, r)
+	if !ok {
+		return
+	}
+
+	snippets, err := app.snippets.ForOrganization(r.Context(), organization.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	members, err := app.organizations.Members(r.Context(), organization.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Organization = organization
+	data.Snippets = snippets
+	data.Members = members
+	data.Form = &orgMemberAddForm{Role: models.OrgRoleMember}
+
+	app.render(w, r, http.StatusOK, "org_view.tmpl", data)
+}
+
+// Adds an existing user to the organization. Owners only.
+func (app *application) orgMemberAddPost(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.orgOwnership(w, r)
+	if !ok {
+		return
+	}
+
+	var form orgMemberAddForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.PermittedValue(form.Role, models.OrgRoleOwner, models.OrgRoleMember), "role", "This field must be owner or member")
+
+	var user *models.User
+	if form.Valid() {
+		user, err = app.users.GetByEmail(r.Context(), form.Email)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+			form.AddFieldError("email", "There is no user with this email address")
+		}
+	}
+	if form.Valid() {
+		_, err = app.organizations.MemberRole(r.Context(), organization.ID, user.ID)
+		if err == nil {
+			form.AddFieldError("email", "This user is already a member")
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		snippets, err := app.snippets.ForOrganization(r.Context(), organization.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		members, err := app.organizations.Members(r.Context(), organization.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.Organization = organization
+		data.Snippets = snippets
+		data.Members = members
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "org_view.tmpl", data)
+		return
+	}
+
+	err = app.organizations.AddMember(r.Context(), organization.ID, user.ID, form.Role)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s has been added to %s.", user.Name, organization.Name))
+	http.Redirect(w, r, fmt.Sprintf("/org/view/%d", organization.ID), http.StatusSeeOther)
+}
+
+// Removes a member from the organization. Owners only, and owners can't
+// remove themselves so an organization always keeps an owner.
+func (app *application) orgMemberRemovePost(w http.ResponseWriter, r *http.Request) {
+	organization, ok := app.orgOwnership(w, r)
+	if !ok {
+		return
+	}
+
+	var form orgMemberRemoveForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.UserID == app.authenticatedUser(r).ID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.organizations.RemoveMember(r.Context(), organization.ID, form.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The member has been removed.")
+	http.Redirect(w, r, fmt.Sprintf("/org/view/%d", organization.ID), http.StatusSeeOther)
+}
+
+// orgMembership loads the organization named by the :id route parameter and
+// checks the user belongs to it. Non-members get a 404, so they can't tell
+// which organizations exist. If it returns false a response has been sent.
+func (app *application) orgMembership(w http.ResponseWriter, r *http.Request) (*models.Organization, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil, false
+	}
+
+	role, err := app.organizations.MemberRole(r.Context(), id, app.authenticatedUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	organization, err := app.organizations.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+	organization.Role = role
+
+	return organization, true
+}
+
+// orgOwnership is like orgMembership, but also requires the user to be an
+// owner of the organization.
+func (app *application) orgOwnership(w http.ResponseWriter, r *http.Request) (*models.Organization, bool) {
+	organization, ok := app.orgMembership(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if organization.Role != models.OrgRoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return organization, true
+}
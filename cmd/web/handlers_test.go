@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"github.com/minhnghia2k3/snippet_box/internal/models/mocks"
 	"net/http"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func TestPing(t *testing.T) {
@@ -212,3 +216,421 @@ func TestUserSignup(t *testing.T) {
 //		assert.StringContains(t, body, "<form action='/snippet/create' method='POST'>")
 //	})
 //}
+
+func TestUserLoginLockout(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	login := func(password string) (int, string) {
+		form := url.Values{}
+		form.Add("email", "real@gmail.com")
+		form.Add("password", password)
+		form.Add("csrf_token", csrfToken)
+		code, _, body := ts.postForm(t, "/user/login", form)
+		return code, body
+	}
+
+	for i := 0; i < 5; i++ {
+		code, body := login("wrongPa$$word")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Email or password is incorrect")
+	}
+
+	// Even the right password is refused while the account is locked.
+	code, body := login("pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.StringContains(t, body, "Too many failed login attempts")
+}
+
+func TestAccountSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Sign in from two different browsers.
+	ts.login(t, "real@gmail.com")
+	firstBrowser := ts.resetClient(t)
+	csrfToken := ts.login(t, "real@gmail.com")
+
+	code, _, body := ts.get(t, "/account/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "This session")
+	assert.StringContains(t, body, "Sign out this session")
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	code, _, _ = ts.postForm(t, "/account/sessions/revoke-others", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// The second browser is still signed in, the first one isn't.
+	code, _, _ = ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusOK)
+
+	ts.Client().Jar = firstBrowser
+	code, headers, _ := ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+}
+
+func TestAccountEmailConfirm(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantLocation string
+	}{
+		{
+			name:         "Valid token",
+			urlPath:      "/account/email/confirm/VALIDTOKEN",
+			wantLocation: "/account/view",
+		},
+		{
+			name:         "Invalid token",
+			urlPath:      "/account/email/confirm/WRONGTOKEN",
+			wantLocation: "/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, _ := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestAccountDelete(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "real@gmail.com")
+
+	tests := []struct {
+		name     string
+		password string
+		snippets string
+		wantCode int
+	}{
+		{
+			name:     "Missing choice",
+			password: "pa$$word",
+			snippets: "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Wrong password",
+			password: "wrongPa$$word",
+			snippets: "delete",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Valid submission",
+			password: "pa$$word",
+			snippets: "anonymise",
+			wantCode: http.StatusSeeOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("password", tt.password)
+			form.Add("snippets", tt.snippets)
+			form.Add("csrf_token", csrfToken)
+			code, _, _ := ts.postForm(t, "/account/delete", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	// The user has been signed out.
+	code, headers, _ := ts.get(t, "/account/view")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+}
+
+func TestAdmin(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Regular user", func(t *testing.T) {
+		ts.resetClient(t)
+		ts.login(t, "real@gmail.com")
+
+		code, _, _ := ts.get(t, "/admin")
+		assert.Equal(t, code, http.StatusForbidden)
+	})
+
+	t.Run("Administrator", func(t *testing.T) {
+		ts.resetClient(t)
+		csrfToken := ts.login(t, "admin@gmail.com")
+
+		code, _, body := ts.get(t, "/admin")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "test@gmail.com")
+
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+
+		code, _, _ = ts.postForm(t, "/admin/users/1/disable", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		// Admins can't disable themselves.
+		code, _, _ = ts.postForm(t, "/admin/users/2/disable", form)
+		assert.Equal(t, code, http.StatusBadRequest)
+
+		code, _, _ = ts.postForm(t, "/admin/snippets/1/delete", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		code, _, _ = ts.postForm(t, "/admin/snippets/2/delete", form)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	app := newTestApplication(t)
+	auditLog := app.auditLog.(*mocks.AuditModel)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", "real@gmail.com")
+	form.Add("password", "wrong")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	ts.postForm(t, "/user/login", form)
+	ts.login(t, "real@gmail.com")
+
+	code, _, body := ts.get(t, "/account/security")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "login.failure: incorrect email or password (real@gmail.com)")
+	assert.StringContains(t, body, "login.success")
+
+	// An admin's doings go in the author's trail, with the admin as the actor.
+	ts.resetClient(t)
+	csrfToken := ts.login(t, "admin@gmail.com")
+	form = url.Values{}
+	form.Add("csrf_token", csrfToken)
+	ts.postForm(t, "/admin/snippets/1/delete", form)
+
+	deletion := auditLog.Events[len(auditLog.Events)-1]
+	assert.Equal(t, deletion.Action, models.AuditSnippetDelete)
+	assert.Equal(t, deletion.UserID, 1)
+	assert.Equal(t, deletion.ActorID, 2)
+
+	code, _, body = ts.get(t, "/admin/audit?user=1&action=login.failure")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "incorrect email or password")
+
+	code, _, _ = ts.get(t, "/admin/audit?from=yesterday")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	code, header, body := ts.get(t, "/admin/audit/export?user=1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "text/csv; charset=utf-8")
+	assert.StringContains(t, body, "id,time,user_id,user_email,actor_id,action,detail,ip,user_agent\n")
+	assert.StringContains(t, body, ",1,,2,snippet.delete,")
+
+	// Values a client controls can't become spreadsheet formulas.
+	for _, userAgent := range []string{`=HYPERLINK("https://example.com")`, "\t=1+1", "\r=1+1"} {
+		auditLog.Insert(context.Background(), &models.AuditEvent{UserID: 3, Action: models.AuditLoginSuccess, UserAgent: userAgent})
+	}
+	_, _, body = ts.get(t, "/admin/audit/export?user=3")
+	assert.StringContains(t, body, `,"'=HYPERLINK(""https://example.com"")"`)
+	assert.StringContains(t, body, ",'\t=1+1\n")
+	assert.StringContains(t, body, ",\"'\r=1+1\"\n")
+
+	// Regular users don't get to see everyone's trail.
+	ts.resetClient(t)
+	ts.login(t, "real@gmail.com")
+	code, _, _ = ts.get(t, "/admin/audit/export")
+	assert.Equal(t, code, http.StatusForbidden)
+}
+
+func TestFeeds(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.get(t, "/feed.atom")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "application/atom+xml; charset=utf-8")
+	assert.StringContains(t, body, `<feed xmlns="http://www.w3.org/2005/Atom">`)
+	assert.StringContains(t, body, "<title>An old silent pond</title>")
+	assert.StringContains(t, body, "<id>https://snippetbox.example.com/snippet/view/1</id>")
+
+	// Without -base-url, debug mode builds links from the request's host.
+	app.baseURL, app.debug = "", true
+	_, _, body = ts.get(t, "/feed.atom")
+	assert.StringContains(t, body, "<id>"+ts.URL+"/snippet/view/1</id>")
+	app.baseURL, app.debug = "https://snippetbox.example.com", false
+
+	code, _, body = ts.get(t, "/users/1/feed.atom")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<title>Snippets by test</title>")
+	assert.StringContains(t, body, "<title>An old silent pond</title>")
+
+	// Feeds can be revalidated.
+	reqHeader := http.Header{}
+	reqHeader.Set("If-None-Match", header.Get("ETag"))
+	code, _, _ = ts.getWithHeaders(t, "/feed.atom", reqHeader)
+	assert.Equal(t, code, http.StatusNotModified)
+
+	// So can empty ones, which were last updated when the user signed up.
+	code, header, body = ts.get(t, "/users/2/feed.atom")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<updated>2024-01-01T12:00:00Z</updated>")
+	assert.Equal(t, header.Get("Last-Modified"), "Mon, 01 Jan 2024 12:00:00 GMT")
+	reqHeader.Set("If-None-Match", header.Get("ETag"))
+	code, _, _ = ts.getWithHeaders(t, "/users/2/feed.atom", reqHeader)
+	assert.Equal(t, code, http.StatusNotModified)
+
+	// The path the feed was asked for under redirects to it.
+	code, header, _ = ts.get(t, "/user/1/feed.atom")
+	assert.Equal(t, code, http.StatusMovedPermanently)
+	assert.Equal(t, header.Get("Location"), "/users/1/feed.atom")
+
+	for _, path := range []string{"/users/99/feed.atom", "/users/foo/feed.atom", "/user/foo/feed.atom", "/user/1/2/feed.atom"} {
+		code, _, _ = ts.get(t, path)
+		assert.Equal(t, code, http.StatusNotFound)
+	}
+}
+
+func TestDisabledLogin(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "disabled@gmail.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	code, _, body := ts.postForm(t, "/user/login", form)
+
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.StringContains(t, body, "This account has been disabled")
+}
+
+func TestOrganizationVisibility(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		email    string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Anonymous snippet",
+			urlPath:  "/snippet/view/3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-member snippet",
+			email:    "admin@gmail.com",
+			urlPath:  "/snippet/view/3",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Member snippet",
+			email:    "real@gmail.com",
+			urlPath:  "/snippet/view/3",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Non-member organization",
+			email:    "admin@gmail.com",
+			urlPath:  "/org/view/1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Member organization",
+			email:    "real@gmail.com",
+			urlPath:  "/org/view/1",
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.resetClient(t)
+			if tt.email != "" {
+				ts.login(t, tt.email)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusOK {
+				assert.StringContains(t, body, "Over the wintry forest")
+			}
+		})
+	}
+}
+
+func TestSnippetCaching(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	for _, urlPath := range []string{"/snippet/view/1", "/snippet/raw/1"} {
+		t.Run(urlPath, func(t *testing.T) {
+			code, header, _ := ts.get(t, urlPath)
+			assert.Equal(t, code, http.StatusOK)
+
+			etag := header.Get("ETag")
+			assert.Equal(t, etag != "", true)
+			// The snippet expires in a day, so the cache lifetime is capped at
+			// snippetMaxAge rather than at the expiry.
+			assert.StringContains(t, header.Get("Cache-Control"), "max-age=300")
+
+			code, _, body := ts.getWithHeaders(t, urlPath, http.Header{"If-None-Match": {`"stale", ` + etag}})
+			assert.Equal(t, code, http.StatusNotModified)
+			assert.Equal(t, body, "")
+
+			code, _, _ = ts.getWithHeaders(t, urlPath, http.Header{"If-None-Match": {`"stale"`}})
+			assert.Equal(t, code, http.StatusOK)
+
+			code, _, _ = ts.getWithHeaders(t, urlPath, http.Header{"If-Modified-Since": {header.Get("Last-Modified")}})
+			assert.Equal(t, code, http.StatusNotModified)
+
+			yesterday := time.Now().Add(-24 * time.Hour).UTC().Format(http.TimeFormat)
+			code, _, _ = ts.getWithHeaders(t, urlPath, http.Header{"If-Modified-Since": {yesterday}})
+			assert.Equal(t, code, http.StatusOK)
+		})
+	}
+
+	t.Run("Raw content", func(t *testing.T) {
+		code, header, body := ts.get(t, "/snippet/raw/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+		assert.StringContains(t, header.Get("Cache-Control"), "public")
+		assert.Equal(t, body, "An old silent pond")
+	})
+
+	t.Run("Organization snippet", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/raw/3")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Signed in", func(t *testing.T) {
+		ts.login(t, "real@gmail.com")
+
+		code, header, _ := ts.get(t, "/snippet/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("ETag"), "")
+
+		code, header, _ = ts.get(t, "/snippet/raw/3")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, header.Get("Cache-Control"), "private")
+	})
+}
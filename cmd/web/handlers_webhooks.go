@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"github.com/minhnghia2k3/snippet_box/internal/validator"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Form for registering a webhook
+type webhookCreateForm struct {
+	URL                 string `form:"url"`
+	validator.Validator `form:"-"`
+}
+
+// Form for redelivering a past delivery
+type webhookRedeliverForm struct {
+	Delivery            int `form:"delivery"`
+	validator.Validator `form:"-"`
+}
+
+// GET: /account/webhooks
+// Lists the user's webhooks, with a form to register one.
+func (app *application) webhookList(w http.ResponseWriter, r *http.Request) {
+	app.renderWebhooks(w, r, http.StatusOK, &webhookCreateForm{})
+}
+
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request, status int, form *webhookCreateForm) {
+	webhooks, err := app.webhooks.ForUser(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhooks = webhooks
+	data.Form = form
+
+	app.render(w, r, status, "webhooks.tmpl", data)
+}
+
+// POST: /account/webhooks
+// Registers a webhook, which is sent the events of the user's snippets.
+func (app *application) webhookCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form webhookCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.URL), "url", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.URL, 2048), "url", "This field cannot be longer than 2048 characters")
+	u, err := url.Parse(form.URL)
+	form.CheckField(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "This field must be an http or https URL")
+	if !form.Valid() {
+		app.renderWebhooks(w, r, http.StatusUnprocessableEntity, &form)
+		return
+	}
+
+	webhook, err := app.webhooks.Insert(r.Context(), app.authenticatedUser(r).ID, form.URL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook successfully registered!")
+	http.Redirect(w, r, fmt.Sprintf("/account/webhooks/%d", webhook.ID), http.StatusSeeOther)
+}
+
+// GET: /account/webhooks/1
+// Shows a webhook's secret and its latest deliveries.
+func (app *application) webhookView(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookOwnership(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.webhooks.Deliveries(r.Context(), webhook.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhook = webhook
+	data.Deliveries = deliveries
+
+	app.render(w, r, http.StatusOK, "webhook_view.tmpl", data)
+}
+
+// POST: /account/webhooks/1/delete
+func (app *application) webhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookOwnership(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.webhooks.Delete(r.Context(), webhook.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The webhook has been deleted.")
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+// POST: /account/webhooks/1/redeliver
+// Queues the payload of a past delivery again, as a new delivery.
+func (app *application) webhookRedeliverPost(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookOwnership(w, r)
+	if !ok {
+		return
+	}
+
+	var form webhookRedeliverForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.webhooks.Redeliver(r.Context(), webhook.ID, form.Delivery)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	if app.webhookWorker != nil {
+		app.webhookWorker.notify()
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Delivery #%d has been queued again.", form.Delivery))
+	http.Redirect(w, r, fmt.Sprintf("/account/webhooks/%d", webhook.ID), http.StatusSeeOther)
+}
+
+// webhookOwnership loads the webhook named by the :id route parameter and
+// checks it belongs to the user. Other users get a 404, so they can't tell
+// which webhooks exist. If it returns false a response has been sent.
+func (app *application) webhookOwnership(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil, false
+	}
+
+	webhook, err := app.webhooks.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	if webhook.UserID != app.authenticatedUser(r).ID {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return webhook, true
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long each readiness check gets before it counts as failed.
+const healthCheckTimeout = 2 * time.Second
+
+// pinger is what the readiness probe needs of the database.
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// healthCheck is one of the checks behind the health probes.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// checkResult is how a health check is reported in the probe responses. The
+// probes are public, so the errors of failed checks, which may name hosts and
+// users, are logged rather than reported.
+type checkResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+}
+
+// healthReport is the JSON body of the probe responses.
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// The healthz() handler is the liveness probe. It only checks the state of the
+// process itself, so that an outage of the database doesn't get the server
+// restarted for nothing.
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	app.writeHealth(w, r, false, app.livenessChecks())
+}
+
+// The readyz() handler is the readiness probe. It checks everything a request
+// may need, and fails as soon as the server starts shutting down so that load
+// balancers stop sending it traffic.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	checks := append(app.livenessChecks(),
+		healthCheck{"database", app.checkDatabase},
+		healthCheck{"session_store", app.checkSessionStore},
+	)
+	app.writeHealth(w, r, app.shuttingDown.Load(), checks)
+}
+
+func (app *application) livenessChecks() []healthCheck {
+	return []healthCheck{{"templates", app.checkTemplates}}
+}
+
+// The writeHealth() method runs checks concurrently and writes the report:
+// 200 OK when every check passed, or else 503 Service Unavailable.
+func (app *application) writeHealth(w http.ResponseWriter, r *http.Request, shuttingDown bool, checks []healthCheck) {
+	report := healthReport{Status: "ok", Checks: make(map[string]checkResult)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(ctx)
+			result := checkResult{Status: "ok", Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = "failed"
+				app.requestLogger(r).Error("health check failed", "check", c.name, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if err != nil {
+				report.Status = "unavailable"
+			}
+		}()
+	}
+	wg.Wait()
+
+	if shuttingDown {
+		report.Status = "shutting_down"
+	}
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	body, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+func (app *application) checkTemplates(ctx context.Context) error {
+	if _, ok := app.templateCache["home.tmpl"]; !ok {
+		return errors.New("template cache is empty")
+	}
+	return nil
+}
+
+func (app *application) checkDatabase(ctx context.Context) error {
+	if app.db == nil {
+		return errors.New("no database")
+	}
+	return app.db.PingContext(ctx)
+}
+
+// checkSessionStore looks up a session which doesn't exist. The stores don't
+// take a context, so the lookup is abandoned rather than cancelled when it
+// takes too long.
+func (app *application) checkSessionStore(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := app.sessionManager.Store.Find("readiness-check")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type fakeDB struct {
+	err error
+}
+
+func (db fakeDB) PingContext(ctx context.Context) error {
+	return db.err
+}
+
+func TestHealth(t *testing.T) {
+	app := newTestApplication(t)
+	app.db = fakeDB{}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	var body string
+	probe := func(path string) (int, healthReport) {
+		t.Helper()
+		var code int
+		code, _, body = ts.get(t, path)
+		var report healthReport
+		err := json.Unmarshal([]byte(body), &report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code, report
+	}
+
+	code, report := probe("/healthz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, report.Status, "ok")
+	assert.Equal(t, len(report.Checks), 1)
+	assert.Equal(t, report.Checks["templates"].Status, "ok")
+
+	code, report = probe("/readyz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, report.Status, "ok")
+	for _, name := range []string{"templates", "database", "session_store"} {
+		assert.Equal(t, report.Checks[name].Status, "ok")
+	}
+
+	// A database outage makes the server not ready, but still alive.
+	app.db = fakeDB{err: errors.New("connection refused")}
+
+	code, report = probe("/readyz")
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	assert.Equal(t, report.Status, "unavailable")
+	assert.Equal(t, report.Checks["database"].Status, "failed")
+	// The error itself is only logged.
+	assert.Equal(t, strings.Contains(body, "connection refused"), false)
+
+	code, _ = probe("/healthz")
+	assert.Equal(t, code, http.StatusOK)
+
+	// So does shutting down.
+	app.db = fakeDB{}
+	app.shuttingDown.Store(true)
+
+	code, report = probe("/readyz")
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	assert.Equal(t, report.Status, "shutting_down")
+}
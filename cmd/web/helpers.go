@@ -2,28 +2,39 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"time"
 )
 
-// The serverError helper writers an error message and stack trace to the errorLog
-// and sends 500 Internal server error response.
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	// report file name and line number where actually error from.
-	app.errorLog.Output(2, trace)
+// The serverError helper logs an error message and stack trace, with the request ID,
+// and sends 500 Internal server error response. A database query which timed
+// out gets 503 Service Unavailable instead, as the request may well succeed
+// when retried.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	stack := string(debug.Stack())
+	app.requestLogger(r).Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI(), "stack", stack)
+	trace := err.Error() + "\n" + stack
+
+	status := http.StatusInternalServerError
+	var timeoutError *models.QueryTimeoutError
+	if errors.As(err, &timeoutError) {
+		status = http.StatusServiceUnavailable
+	}
 
 	if app.debug == true {
-		http.Error(w, trace, http.StatusInternalServerError)
+		http.Error(w, trace, status)
 		return
 	}
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	http.Error(w, http.StatusText(status), status)
 }
 
 // The clientError helper sends a status code and corresponding description
@@ -40,25 +51,40 @@ func (app *application) notFound(w http.ResponseWriter) {
 // Helper render() takes response status, page (ex: "home.tmpl"), and struct templateData
 // This will get the page from `templateCache` map,
 // execute template to buffer then write to response writer (two-stage process).
-func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data *templateData) {
+	buf, err := app.renderPage(r.Context(), page, data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(status)
+
+	buf.WriteTo(w)
+}
+
+// Helper renderPage() executes the page into a buffer without writing it, for
+// handlers which need to look at the bytes first.
+func (app *application) renderPage(ctx context.Context, page string, data *templateData) (*bytes.Buffer, error) {
+	_, span := tracer.Start(ctx, "render "+page)
+	defer span.End()
+	defer func(start time.Time) {
+		app.metrics.observeTemplate(page, time.Since(start))
+	}(time.Now())
+
 	ts, ok := app.templateCache[page]
 	if !ok {
-		err := fmt.Errorf("the template %s does not exists", page)
-		app.serverError(w, err)
-		return
+		return nil, fmt.Errorf("the template %s does not exists", page)
 	}
 
 	buf := new(bytes.Buffer)
 
 	err := ts.ExecuteTemplate(buf, "base", data)
 	if err != nil {
-		app.serverError(w, err)
-		return
+		return nil, err
 	}
 
-	w.WriteHeader(status)
-
-	buf.WriteTo(w)
+	return buf, nil
 }
 
 // Which returns pointer to a templateData struct with the current year.
@@ -67,6 +93,7 @@ func (app *application) newTemplateData(r *http.Request) *templateData {
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
+		IsAdmin:         app.isAdmin(r),
 		CSRFToken:       nosurf.Token(r),
 	}
 }
@@ -97,3 +124,75 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// Returns true if the current request is from an administrator
+func (app *application) isAdmin(r *http.Request) bool {
+	user := app.authenticatedUser(r)
+	return user != nil && user.Role == models.RoleAdmin
+}
+
+// canViewSnippet reports whether the request may see the snippet. Snippets
+// visible to their organization only are shown to its members.
+func (app *application) canViewSnippet(r *http.Request, snippet *models.Snippet) (bool, error) {
+	if snippet.Visibility != models.VisibilityOrganization {
+		return true, nil
+	}
+
+	user := app.authenticatedUser(r)
+	if user == nil {
+		return false, nil
+	}
+
+	_, err := app.organizations.MemberRole(r.Context(), snippet.OrganizationID, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Returns the authenticated user making the request, or nil.
+func (app *application) authenticatedUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	return user
+}
+
+// Returns the IP address of the client that sent the request.
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// The background() helper runs fn in a new goroutine, recovering and logging
+// any panic so it can't bring down the server. The WaitGroup lets the caller
+// wait for background work to finish.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprint(err), "stack", string(debug.Stack()))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// Returns an absolute URL for path on this server, for use in emails, feeds,
+// webhooks and the API. Only debug mode, without -base-url, trusts the Host
+// header of the request.
+func (app *application) absoluteURL(r *http.Request, path string) string {
+	if app.baseURL != "" {
+		return app.baseURL + path
+	}
+	return "https://" + r.Host + path
+}
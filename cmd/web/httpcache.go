@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The longest a client may reuse a snippet response without revalidating it.
+// Snippets can't change, but they can be deleted.
+const snippetMaxAge = 5 * time.Minute
+
+// The serveCacheable() function writes body with a strong ETag over its bytes
+// and lastModified as its Last-Modified time, or 304 Not Modified if the
+// request already holds it. The Cache-Control max-age runs out no later than
+// expires. scope is "public" for responses which are the same for everyone,
+// and "private" otherwise.
+func serveCacheable(w http.ResponseWriter, r *http.Request, body []byte, lastModified, expires time.Time, scope string) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	maxAge := min(snippetMaxAge, time.Until(expires)) / time.Second
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, maxAge))
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// The notModified() function evaluates the If-None-Match and If-Modified-Since
+// headers of r. If-Modified-Since is ignored when If-None-Match is present, as
+// RFC 9110 requires.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// The newLogger() function returns a logger writing to w in the given format,
+// "text" or "json", at or above the given level ("debug", "info", "warn" or
+// "error").
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	err := lvl.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+// The fatal() function logs err and exits, like log.Fatal. Deferred calls
+// don't run.
+func fatal(logger *slog.Logger, err error) {
+	logger.Error(err.Error())
+	os.Exit(1)
+}
+
+// Header carrying the ID of a request, from the client or a proxy in front of
+// us, and back in the response.
+const requestIDHeader = "X-Request-ID"
+
+// The requestID() middleware gives every request an ID, which is logged with
+// everything about the request. A well-formed ID from the client, typically
+// set by a proxy, is kept so that logs can be matched up; otherwise a new one
+// is generated.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request.id", id))
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Request IDs from clients end up in the logs, so they're limited to a modest
+// length and a safe set of characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Returns the ID of the request ctx belongs to, or "".
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// Returns the application logger, annotated with the ID of request r.
+func (app *application) requestLogger(r *http.Request) *slog.Logger {
+	return app.logger.With("request_id", requestIDFrom(r.Context()))
+}
+
+// What logRequest learns about a request from handlers further down the chain.
+type requestLog struct {
+	userID int
+	route  string
+}
+
+// Records the user making the request ctx belongs to, for the access log.
+func setLoggedUser(ctx context.Context, userID int) {
+	if entry, ok := ctx.Value(requestLogContextKey).(*requestLog); ok {
+		entry.userID = userID
+	}
+}
+
+// Records the route pattern the request ctx belongs to matched, for the access
+// log and the request metrics.
+func setLoggedRoute(ctx context.Context, route string) {
+	if entry, ok := ctx.Value(requestLogContextKey).(*requestLog); ok {
+		entry.route = route
+	}
+}
+
+// The logRequest() middleware writes a single access log line for every
+// request once it has been served, and records it in the metrics.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &requestLog{}
+		rw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		ctx := context.WithValue(r.Context(), requestLogContextKey, entry)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+		duration := time.Since(start)
+
+		attrs := []any{
+			"request_id", requestIDFrom(r.Context()),
+			"ip", app.clientIP(r),
+			"proto", r.Proto,
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"status", rw.status,
+			"bytes", rw.bytes,
+			"duration", duration,
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, "user_id", entry.userID)
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			attrs = append(attrs, "trace_id", sc.TraceID().String())
+		}
+		app.logger.Info("request", attrs...)
+
+		app.metrics.observeRequest(entry.route, r.Method, rw.status, duration)
+	})
+}
+
+// loggingResponseWriter records the status code and size of a response.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (w *loggingResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *loggingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
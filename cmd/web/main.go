@@ -1,45 +1,80 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/alexedwards/scs/postgresstore"
+	"github.com/alexedwards/scs/sqlite3store"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/minhnghia2k3/snippet_box/internal/mailer"
 	"github.com/minhnghia2k3/snippet_box/internal/models"
-)
-
-type config struct {
-	addr      string
-	staticDir string
-	dsn       string
-}
-
-var (
-	Red   = "\033[31m"
-	Blue  = "\033[34m"
-	White = "\033[97m"
-	Gray  = "\033[37m"
+	"go.opentelemetry.io/otel"
+	_ "modernc.org/sqlite"
 )
 
 // struct application will inject to the handlers.
 type application struct {
 	debug          bool
-	errorLog       *log.Logger
-	infoLog        *log.Logger
+	logger         *slog.Logger
 	snippets       models.SnippetModelInterface
 	users          models.UserModelInterface
+	tokens         models.TokenModelInterface
+	organizations  models.OrganizationModelInterface
+	auditLog       models.AuditModelInterface
+	webhooks       models.WebhookModelInterface
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+	mailer         *mailer.Mailer
+	// Public URL of the server without a trailing slash, or empty in debug
+	// mode to build links from the request's host.
+	baseURL string
+	// The cache in front of snippets, or nil without one. Changes to snippets
+	// which don't go through snippets must invalidate it.
+	snippetCache *models.SnippetCache
+	// Failed login attempts, tracked per account and per client IP.
+	accountThrottle *loginThrottle
+	ipThrottle      *loginThrottle
+	// How long reads stay on the primary database after a user's own write,
+	// while replicas catch up. Zero without replicas.
+	primaryWindow time.Duration
+	// Reverse proxies whose X-Forwarded-* headers are trusted.
+	trustedProxies []netip.Prefix
+	// Whether cookies are only sent over HTTPS.
+	secureCookies bool
+	// Token buckets of the rate limits, and the limits.
+	rateLimits  rateLimitStore
+	signupLimit rateLimit
+	writeLimit  rateLimit
+	// Sends webhook deliveries, woken up when events are queued.
+	webhookWorker *webhookWorker
+	// Prometheus metrics, or nil when they aren't served.
+	metrics *metrics
+	// The database, for the readiness probe.
+	db pinger
+	// Set once the server starts shutting down, failing the readiness probe.
+	shuttingDown  atomic.Bool
+	shutdownDelay time.Duration
+	wg            sync.WaitGroup
 }
 
 /*
@@ -64,76 +99,352 @@ This function will:
 - Creating a server instance.
 */
 func main() {
-	var cfg config
-	flag.StringVar(&cfg.addr, "addr", ":4000", "HTTP network address")
-	debug := flag.Bool("debug", false, "Application debug mode")
-	flag.StringVar(&cfg.staticDir, "static-dir", "./ui/static", "Path to static address")
-	flag.StringVar(&cfg.dsn, "dsn", "web:secret@tcp(localhost:3306)/snippetbox?parseTime=true", "MySQL data source name")
-	// Must call before use the addr variable
-	flag.Parse()
-
-	infoLog := log.New(os.Stdout, Blue+"[INFO]\t"+Gray, log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, Red+"[ERROR]\t"+Gray, log.Lshortfile|log.Ldate|log.Ltime)
-
-	db, err := openDB(cfg.dsn)
+	// Until the configuration says otherwise, log as text.
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	cfg, err := loadConfig(fs, os.Args[1:], os.Getenv)
 	if err != nil {
-		errorLog.Fatal(err)
+		fatal(logger, err)
+	}
+
+	err = cfg.validate()
+	if cfg.printConfig {
+		cfg.print(os.Stdout, fs)
+		if err != nil {
+			fatal(logger, err)
+		}
+		return
+	}
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	logger, err = newLogger(os.Stdout, cfg.log.format, cfg.log.level)
+	if err != nil {
+		fatal(slog.Default(), err)
+	}
+
+	db, err := openDB(cfg.dbDriver, cfg.dsn)
+	if err != nil {
+		fatal(logger, err)
 	}
 
 	defer db.Close()
+	db.QueryTimeout = cfg.queryTimeout
+
+	// "web [flags] migrate ..." manages the schema instead of starting the server.
+	if fs.Arg(0) == "migrate" {
+		if err := runMigrate(db, fs.Args()[1:], os.Stdout); err != nil {
+			fatal(logger, err)
+		}
+		return
+	}
+
+	// So do "web [flags] user ...", "snippets ...", "export" and "import",
+	// which manage users and data.
+	if adminCommands[fs.Arg(0)] {
+		m := newAdminModels(db, cfg.bcryptCost)
+		defer stopCleanup(m.sessions.Store)
+		if err := runAdmin(m, fs.Args(), os.Stdin, os.Stdout); err != nil {
+			fatal(logger, err)
+		}
+		return
+	}
+
+	// Links sent out by the server, in emails, feeds, webhooks and the API,
+	// can't be built from a Host header anyone can set.
+	if cfg.baseURL == "" && !cfg.debug {
+		fatal(logger, errors.New("base-url: must be set unless debug is on"))
+	}
+
+	if len(cfg.replicas.dsns) > 0 {
+		db.Replicas, err = openReplicas(cfg.dbDriver, cfg.replicas.dsns)
+		if err != nil {
+			fatal(logger, err)
+		}
+		defer db.Replicas.Close()
+
+		db.Replicas.Check(context.Background(), replicaCheckTimeout)
+		logger.Info("read replicas checked", "healthy", db.Replicas.Healthy(), "total", len(cfg.replicas.dsns))
+
+		// Stop health checking once the server has shut down.
+		ctx, stopMonitor := context.WithCancel(context.Background())
+		defer stopMonitor()
+		go db.Replicas.Monitor(ctx, replicaCheckInterval, replicaCheckTimeout)
+	}
 
 	// Initialize a new instance of our application struct
 	templateCache, err := newTemplateCache()
 	if err != nil {
-		errorLog.Fatal(err)
+		fatal(logger, err)
 	}
 	formDecoder := form.NewDecoder()
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
-	// Serve request on HTTPS only
-	sessionManager.Cookie.Secure = true
+	snippets, snippetCache := newSnippetModel(db, cfg.cache.size, cfg.cache.ttl)
+	// Metrics are only collected when something will read them.
+	var serverMetrics *metrics
+	if cfg.metricsAddr != "" {
+		serverMetrics = newMetrics(db, snippetCache)
+	}
+
+	sessionManager.Store = serverMetrics.sessionStore(newSessionStore(db))
+	defer stopCleanup(sessionManager.Store)
+	sessionManager.Lifetime = cfg.sessionLifetime
+	// Only send the session cookie over HTTPS, unless told otherwise.
+	sessionManager.Cookie.Secure = cfg.secureCookies
+
+	trustedProxies, err := parseTrustedProxies(cfg.trustedProxies)
+	if err != nil {
+		fatal(logger, err)
+	}
 
 	app := &application{
-		debug:          *debug,
-		errorLog:       errorLog,
-		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{DB: db},
-		users:          &models.UserModel{DB: db},
+		debug:          cfg.debug,
+		baseURL:        strings.TrimSuffix(cfg.baseURL, "/"),
+		logger:         logger,
+		snippets:       snippets,
+		snippetCache:   snippetCache,
+		users:          &models.UserModel{DB: db, BcryptCost: cfg.bcryptCost},
+		tokens:         &models.TokenModel{DB: db},
+		organizations:  &models.OrganizationModel{DB: db},
+		auditLog:       &models.AuditModel{DB: db},
+		webhooks:       &models.WebhookModel{DB: db},
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		mailer:         mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender, logger),
+		// An account gets 5 free attempts, an IP (which may be shared) gets 20.
+		accountThrottle: newLoginThrottle(5, 30*time.Second, 30*time.Minute, time.Hour),
+		ipThrottle:      newLoginThrottle(20, 30*time.Second, 30*time.Minute, time.Hour),
+		trustedProxies:  trustedProxies,
+		secureCookies:   cfg.secureCookies,
+		metrics:         serverMetrics,
+		rateLimits:      newMemoryRateStore(),
+		signupLimit:     cfg.rateLimits.signup,
+		writeLimit:      cfg.rateLimits.write,
+		db:              db,
+		shutdownDelay:   cfg.timeouts.shutdownDelay,
+	}
+	if cfg.rateLimits.store == "database" {
+		app.rateLimits = &dbRateStore{model: &models.RateLimitModel{DB: db}}
 	}
+	if db.Replicas != nil {
+		app.primaryWindow = cfg.replicas.window
+	}
+
+	if cfg.tracing.endpoint != "" {
+		tracerProvider, err := newTracerProvider(context.Background(), cfg.tracing.endpoint, cfg.tracing.sampleRatio)
+		if err != nil {
+			fatal(logger, err)
+		}
+		// Export the spans still buffered once the server has stopped.
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			tracerProvider.Shutdown(ctx)
+		}()
 
-	tlsConfig := &tls.Config{
-		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		otel.SetTracerProvider(tracerProvider)
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			logger.Warn("tracing", "error", err)
+		}))
+		app.traceModels()
 	}
 
+	if cfg.autoMigrate {
+		if err := autoMigrate(db, logger); err != nil {
+			fatal(logger, err)
+		}
+	}
+
+	// Send webhook deliveries until the servers have stopped, and wait for
+	// the one being sent before the database is closed.
+	app.webhookWorker = newWebhookWorker(app.webhooks, logger, cfg.webhookAllowPrivate)
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		app.webhookWorker.run(workerCtx)
+	}()
+	defer func() {
+		stopWorker()
+		<-workerDone
+	}()
+
+	// The servers log their errors, such as TLS handshake failures, through
+	// the application logger.
+	errorLog := slog.NewLogLogger(logger.Handler(), slog.LevelError)
+
 	srv := &http.Server{
-		Addr:      cfg.addr,
-		Handler:   app.routes(),
-		ErrorLog:  errorLog,
-		TLSConfig: tlsConfig,
+		Addr:     cfg.addr,
+		Handler:  app.routes(),
+		ErrorLog: errorLog,
 
 		// Add Idle, Read and Write timeouts to the server.
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.timeouts.idle,
+		ReadTimeout:  cfg.timeouts.read,
+		WriteTimeout: cfg.timeouts.write,
 	}
 
-	infoLog.Printf("Server is listening on port %s", cfg.addr)
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errorLog.Fatal(err)
+	if !cfg.plainHTTP {
+		cert, err := tls.LoadX509KeyPair(cfg.tls.certFile, cfg.tls.keyFile)
+		if err != nil {
+			fatal(logger, err)
+		}
+		srv.TLSConfig = &tls.Config{
+			Certificates:     []tls.Certificate{cert},
+			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		}
+	}
+
+	srvs := []*http.Server{srv}
+	addrs := []string{cfg.addr}
+	if cfg.redirectAddr != "" {
+		srvs = append(srvs, &http.Server{
+			Addr:         cfg.redirectAddr,
+			Handler:      redirectToHTTPS(cfg.addr),
+			ErrorLog:     errorLog,
+			IdleTimeout:  cfg.timeouts.idle,
+			ReadTimeout:  cfg.timeouts.read,
+			WriteTimeout: cfg.timeouts.write,
+		})
+		addrs = append(addrs, cfg.redirectAddr)
+	}
+	if cfg.metricsAddr != "" {
+		srvs = append(srvs, &http.Server{
+			Addr:         cfg.metricsAddr,
+			Handler:      serverMetrics.handler(),
+			ErrorLog:     errorLog,
+			IdleTimeout:  cfg.timeouts.idle,
+			ReadTimeout:  cfg.timeouts.read,
+			WriteTimeout: cfg.timeouts.write,
+		})
+		addrs = append(addrs, cfg.metricsAddr)
+	}
+
+	lns, err := listen(addrs...)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	logger.Info("server listening", "addr", lns[0].Addr().String(), "tls", !cfg.plainHTTP)
+	if cfg.redirectAddr != "" {
+		logger.Info("redirecting HTTP to HTTPS", "addr", lns[1].Addr().String())
+	}
+	if cfg.metricsAddr != "" {
+		logger.Info("serving metrics", "addr", lns[len(lns)-1].Addr().String())
+	}
+
+	// Return rather than exit once the servers have stopped, so that the
+	// deferred calls close the database.
+	err = app.serve(srvs, lns, cfg.timeouts.shutdown)
+	if err != nil {
+		fatal(logger, err)
+	}
 }
 
-// The openDB() function wraps sql.Open and returns a sql.DB connection pool.
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+// How often read replicas are health checked, and how long they get to answer.
+const (
+	replicaCheckInterval = 10 * time.Second
+	replicaCheckTimeout  = 2 * time.Second
+)
+
+// The openDB() function wraps sql.Open and returns a connection pool for the
+// given driver, which the models know how to talk to.
+func openDB(driver, dsn string) (*models.DB, error) {
+	db, err := openPool(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
-	return db, nil
+	return &models.DB{DB: db, Driver: driver}, nil
+}
+
+// The openReplicas() function opens the read replicas. Unlike the primary, a
+// replica which can't be reached doesn't stop the server from starting: it is
+// left out until a health check succeeds.
+func openReplicas(driver string, dsns []string) (*models.ReplicaSet, error) {
+	var dbs []*sql.DB
+	for _, dsn := range dsns {
+		db, err := openPool(driver, dsn)
+		if err != nil {
+			for _, db := range dbs {
+				db.Close()
+			}
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	return models.NewReplicaSet(dbs...), nil
+}
+
+// The openPool() function opens a connection pool for the driver without
+// connecting yet.
+func openPool(driver, dsn string) (*sql.DB, error) {
+	var driverName string
+	switch driver {
+	case models.DriverMySQL:
+		driverName = "mysql"
+	case models.DriverPostgres:
+		driverName = "pgx"
+	case models.DriverSQLite:
+		driverName = "sqlite"
+		dsn = sqliteDSN(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+
+	return sql.Open(driverName, dsn)
+}
+
+// The sqliteDSN() function turns a database file path into a DSN which sets
+// the pragmas every connection needs: foreign keys are off by default in
+// SQLite, and without a busy timeout concurrent writers fail immediately with
+// SQLITE_BUSY instead of waiting for the lock.
+func sqliteDSN(path string) string {
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	return path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+// The newSnippetModel() function returns the snippet model, behind a cache
+// unless its size is zero, and the cache.
+func newSnippetModel(db *models.DB, cacheSize int, cacheTTL time.Duration) (models.SnippetModelInterface, *models.SnippetCache) {
+	snippets := &models.SnippetModel{DB: db}
+	if cacheSize <= 0 {
+		return snippets, nil
+	}
+	cache := models.NewSnippetCache(snippets, cacheSize, cacheTTL)
+	return cache, cache
+}
+
+// The newSessionStore() function returns the scs store matching the database
+// driver. All of them expect a "sessions" table.
+func newSessionStore(db *models.DB) scs.Store {
+	switch db.Driver {
+	case models.DriverPostgres:
+		return postgresstore.New(db.DB)
+	case models.DriverSQLite:
+		return sqlite3store.New(db.DB)
+	default:
+		return mysqlstore.New(db.DB)
+	}
+}
+
+// The stopCleanup() function stops the goroutine with which a session store
+// deletes expired sessions.
+func stopCleanup(store scs.Store) {
+	if s, ok := store.(interface{ StopCleanup() }); ok {
+		s.StopCleanup()
+	}
 }
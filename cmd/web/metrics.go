@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"github.com/alexedwards/scs/v2"
+	"github.com/julienschmidt/httprouter"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Prefix of the names of the application's own metrics.
+const metricsNamespace = "snippetbox"
+
+// metrics holds the Prometheus collectors of the server. A nil *metrics
+// records nothing, so handlers and tests needn't check for one.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	sessionStoreOps  *prometheus.HistogramVec
+	templateDuration *prometheus.HistogramVec
+	logins           *prometheus.CounterVec
+	rateLimitedTotal *prometheus.CounterVec
+}
+
+// The newMetrics() function returns the server metrics, including the
+// connection pool statistics of db and its replicas, the statistics of the
+// snippet cache when there is one, and the Go runtime and process metrics.
+func newMetrics(db *models.DB, snippetCache *models.SnippetCache) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route pattern, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by route pattern, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		sessionStoreOps: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "session_store_operation_duration_seconds",
+			Help:      "Time taken by session store operations, by operation and result.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation", "result"}),
+		templateDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "template_render_duration_seconds",
+			Help:      "Time taken to render page templates, by page.",
+			Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+		}, []string{"page"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "logins_total",
+			Help:      "Login attempts, by result: success, failure, disabled or throttled.",
+		}, []string{"result"}),
+		rateLimitedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Requests refused for going over a rate limit, by limit.",
+		}, []string{"limit"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.sessionStoreOps,
+		m.templateDuration,
+		m.logins,
+		m.rateLimitedTotal,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db.DB, "primary"))
+		if db.Replicas != nil {
+			for i, replica := range db.Replicas.DBs() {
+				m.registry.MustRegister(collectors.NewDBStatsCollector(replica, fmt.Sprintf("replica%d", i+1)))
+			}
+			m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "db_replicas_healthy",
+				Help:      "Read replicas which passed the last health check.",
+			}, func() float64 { return float64(db.Replicas.Healthy()) }))
+		}
+	}
+
+	if snippetCache != nil {
+		m.registry.MustRegister(
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "snippet_cache_hits_total",
+				Help:      "Snippet lookups answered by the cache.",
+			}, func() float64 { return float64(snippetCache.Stats().Hits) }),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "snippet_cache_misses_total",
+				Help:      "Snippet lookups the cache had to pass on to the database.",
+			}, func() float64 { return float64(snippetCache.Stats().Misses) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "snippet_cache_entries",
+				Help:      "Snippets held in the cache.",
+			}, func() float64 { return float64(snippetCache.Stats().Entries) }),
+		)
+	}
+
+	return m
+}
+
+// The handler() method returns the handler of the metrics listener, which
+// serves the metrics to Prometheus on /metrics.
+func (m *metrics) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+// Records a request to route, the pattern it matched, which was served with
+// status in duration.
+func (m *metrics) observeRequest(route, method string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = "unmatched"
+	}
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.requestDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+// Records the rendering of a page template.
+func (m *metrics) observeTemplate(page string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.templateDuration.WithLabelValues(page).Observe(duration.Seconds())
+}
+
+// Records the result of a login attempt.
+func (m *metrics) login(result string) {
+	if m == nil {
+		return
+	}
+	m.logins.WithLabelValues(result).Inc()
+}
+
+// Counts a request refused by the named rate limit.
+func (m *metrics) rateLimited(limit string) {
+	if m == nil {
+		return
+	}
+	m.rateLimitedTotal.WithLabelValues(limit).Inc()
+}
+
+// Records a session store operation which started at start.
+func (m *metrics) observeSessionStore(operation string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.sessionStoreOps.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+// The sessionStore() method wraps store so that its operations are measured.
+func (m *metrics) sessionStore(store scs.Store) scs.Store {
+	if m == nil {
+		return store
+	}
+	return &measuredStore{store: store, metrics: m}
+}
+
+// measuredStore is a session store recording the duration and result of every
+// operation of the store it wraps.
+type measuredStore struct {
+	store   scs.Store
+	metrics *metrics
+}
+
+func (s *measuredStore) Find(token string) ([]byte, bool, error) {
+	start := time.Now()
+	b, found, err := s.store.Find(token)
+	s.metrics.observeSessionStore("find", start, err)
+	return b, found, err
+}
+
+func (s *measuredStore) Commit(token string, b []byte, expiry time.Time) error {
+	start := time.Now()
+	err := s.store.Commit(token, b, expiry)
+	s.metrics.observeSessionStore("commit", start, err)
+	return err
+}
+
+func (s *measuredStore) Delete(token string) error {
+	start := time.Now()
+	err := s.store.Delete(token)
+	s.metrics.observeSessionStore("delete", start, err)
+	return err
+}
+
+// All makes the store iterable when the wrapped store is, which the session
+// management pages need.
+func (s *measuredStore) All() (map[string][]byte, error) {
+	iterable, ok := s.store.(scs.IterableStore)
+	if !ok {
+		return nil, fmt.Errorf("session store %T can't be iterated", s.store)
+	}
+
+	start := time.Now()
+	sessions, err := iterable.All()
+	s.metrics.observeSessionStore("all", start, err)
+	return sessions, err
+}
+
+// StopCleanup stops the cleanup goroutine of the wrapped store, if it has one.
+func (s *measuredStore) StopCleanup() {
+	stopCleanup(s.store)
+}
+
+// measuredRouter registers handlers on an httprouter.Router so that the route
+// pattern they were registered with is recorded for the request metrics and
+// names the request span; httprouter doesn't say which pattern a request
+// matched.
+type measuredRouter struct {
+	*httprouter.Router
+}
+
+func (r measuredRouter) Handler(method, path string, handler http.Handler) {
+	r.Router.Handler(method, path, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		setLoggedRoute(req.Context(), path)
+		setSpanRoute(req.Context(), method, path)
+		handler.ServeHTTP(w, req)
+	}))
+}
+
+func (r measuredRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	r.Handler(method, path, handler)
+}
+
+// Make sure the session management pages can keep iterating sessions.
+var _ scs.IterableStore = (*measuredStore)(nil)
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	app.snippetCache = models.NewSnippetCache(app.snippets, 10, time.Minute)
+	app.snippets = app.snippetCache
+	app.metrics = newMetrics(nil, app.snippetCache)
+	app.sessionManager.Store = app.metrics.sessionStore(memstore.New())
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.get(t, "/snippet/view/1")
+	ts.get(t, "/snippet/view/1")
+	ts.get(t, "/snippet/view/2")
+	ts.get(t, "/no/such/page")
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", "real@gmail.com")
+	form.Add("password", "wrong")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+	ts.postForm(t, "/user/login", form)
+	ts.login(t, "real@gmail.com")
+
+	rr := httptest.NewRecorder()
+	app.metrics.handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, rr.Code, http.StatusOK)
+	metrics, _ := io.ReadAll(rr.Body)
+	out := string(metrics)
+
+	for _, want := range []string{
+		`snippetbox_http_requests_total{method="GET",route="/snippet/view/:id",status="200"} 2`,
+		`snippetbox_http_requests_total{method="GET",route="/snippet/view/:id",status="404"} 1`,
+		`snippetbox_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`snippetbox_http_request_duration_seconds_count{method="POST",route="/user/login",status="303"} 1`,
+		`snippetbox_logins_total{result="failure"} 1`,
+		`snippetbox_logins_total{result="success"} 1`,
+		`snippetbox_template_render_duration_seconds_count{page="view.tmpl"} 2`,
+		`snippetbox_session_store_operation_duration_seconds_count{operation="commit",result="ok"}`,
+		`snippetbox_snippet_cache_hits_total 1`,
+		`snippetbox_snippet_cache_misses_total 2`,
+		`snippetbox_snippet_cache_entries 1`,
+		`go_goroutines`,
+	} {
+		assert.StringContains(t, out, want)
+	}
+}
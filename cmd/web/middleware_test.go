@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSecureHeader(t *testing.T) {
@@ -45,3 +50,209 @@ func TestSecureHeader(t *testing.T) {
 
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestReadYourWrites(t *testing.T) {
+	app := newTestApplication(t)
+	app.primaryWindow = time.Minute
+
+	var usesPrimary bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		usesPrimary = models.UsesPrimary(r.Context())
+	})
+	h := app.sessionManager.LoadAndSave(app.readYourWrites(next))
+
+	var cookies []*http.Cookie
+	serve := func(method string) {
+		r, err := http.NewRequest(method, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		if c := rr.Result().Cookies(); len(c) > 0 {
+			cookies = c
+		}
+	}
+
+	serve(http.MethodGet)
+	assert.Equal(t, usesPrimary, false)
+
+	serve(http.MethodPost)
+	assert.Equal(t, usesPrimary, true)
+
+	// The read following the write stays on the primary.
+	serve(http.MethodGet)
+	assert.Equal(t, usesPrimary, true)
+
+	// Until the window is over.
+	app.primaryWindow = time.Nanosecond
+	serve(http.MethodPost)
+	time.Sleep(time.Millisecond)
+	serve(http.MethodGet)
+	assert.Equal(t, usesPrimary, false)
+}
+
+func TestProxyHeaders(t *testing.T) {
+	app := newTestApplication(t)
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.trustedProxies = proxies
+
+	var clientIP string
+	h := app.proxyHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP = app.clientIP(r)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		proto      string
+		wantIP     string
+		wantCode   int
+	}{
+		{"Direct", "203.0.113.7:5000", nil, "", "203.0.113.7", http.StatusOK},
+		{"Untrusted peer", "203.0.113.7:5000", []string{"198.51.100.1"}, "", "203.0.113.7", http.StatusOK},
+		{"Trusted peer", "10.1.2.3:5000", []string{"198.51.100.1"}, "https", "198.51.100.1", http.StatusOK},
+		{"Spoofed hops", "10.1.2.3:5000", []string{"1.1.1.1, 198.51.100.1", "192.168.1.1"}, "", "198.51.100.1", http.StatusOK},
+		{"Only proxies", "10.1.2.3:5000", []string{"10.9.9.9"}, "", "10.9.9.9", http.StatusOK},
+		{"Malformed", "10.1.2.3:5000", []string{"unknown"}, "", "10.1.2.3", http.StatusOK},
+		{"Plain HTTP", "10.1.2.3:5000", []string{"198.51.100.1"}, "http", "", http.StatusPermanentRedirect},
+		{"Untrusted plain HTTP", "203.0.113.7:5000", nil, "http", "203.0.113.7", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientIP = ""
+			r := httptest.NewRequest(http.MethodGet, "http://snippetbox.example.com/about?x=1", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+			assert.Equal(t, clientIP, tt.wantIP)
+			if tt.wantCode == http.StatusPermanentRedirect {
+				assert.Equal(t, rr.Header().Get("Location"), "https://snippetbox.example.com/about?x=1")
+			}
+		})
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		host      string
+		want      string
+	}{
+		{":443", "example.com", "https://example.com/snippet/view/1?a=b"},
+		{":443", "example.com:80", "https://example.com/snippet/view/1?a=b"},
+		{":4000", "example.com:8080", "https://example.com:4000/snippet/view/1?a=b"},
+		{":4000", "[::1]:8080", "https://[::1]:4000/snippet/view/1?a=b"},
+		{":443", "[::1]", "https://[::1]/snippet/view/1?a=b"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/snippet/view/1?a=b", nil)
+		r.Host = tt.host
+
+		rr := httptest.NewRecorder()
+		redirectToHTTPS(tt.httpsAddr).ServeHTTP(rr, r)
+
+		assert.Equal(t, rr.Code, http.StatusPermanentRedirect)
+		assert.Equal(t, rr.Header().Get("Location"), tt.want)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := newTestApplication(t)
+
+	var id string
+	h := app.requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = requestIDFrom(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		wantKept bool
+	}{
+		{"Generated", "", false},
+		{"Propagated", "abc-123_X.y", true},
+		{"Too long", strings.Repeat("a", 65), false},
+		{"Unsafe", "abc\ninjected", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(requestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Header().Get(requestIDHeader), id)
+			assert.Equal(t, id == tt.header, tt.wantKept)
+			assert.Equal(t, validRequestID(id), true)
+		})
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	app := newTestApplication(t)
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.logger = logger
+
+	h := app.requestID(app.logRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setLoggedUser(r.Context(), 42)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/snippet/create?x=1", nil)
+	r.Header.Set(requestIDHeader, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	// A single line for the request.
+	assert.Equal(t, strings.Count(buf.String(), "\n"), 1)
+
+	var line struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		Method    string `json:"method"`
+		URI       string `json:"uri"`
+		Status    int    `json:"status"`
+		Bytes     int    `json:"bytes"`
+		UserID    int    `json:"user_id"`
+		Duration  *int64 `json:"duration"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, line.Msg, "request")
+	assert.Equal(t, line.RequestID, "req-1")
+	assert.Equal(t, line.Method, http.MethodPost)
+	assert.Equal(t, line.URI, "/snippet/create?x=1")
+	assert.Equal(t, line.Status, http.StatusCreated)
+	assert.Equal(t, line.Bytes, 5)
+	assert.Equal(t, line.UserID, 42)
+	assert.Equal(t, line.Duration != nil, true)
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/justinas/nosurf"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
 	"net/http"
+	"time"
 )
 
 /* =============================================================
@@ -25,25 +28,15 @@ func secureHeader(next http.Handler) http.Handler {
 	})
 }
 
-// Middleware that log http request
-func (app *application) logRequest(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 // Middleware that recover if panic occurs
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			// call recover() if error exist log serverError()
 			if err := recover(); err != nil {
-				fmt.Println(err)
 				w.Header().Set("Connection", "close")
 
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 
@@ -56,13 +49,20 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		err := app.sessionManager.RenewToken(r.Context())
 		if err != nil {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		app.sessionManager.Put(r.Context(), "redirect_path", r.RequestURI)
 		if !app.isAuthenticated(r) {
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
+		// Users told to reset their password can't go anywhere else first.
+		user := app.authenticatedUser(r)
+		if user.PasswordResetRequired && r.URL.Path != "/account/password/update" && r.URL.Path != "/user/logout" {
+			app.sessionManager.Put(r.Context(), "flash", "Please choose a new password to continue.")
+			http.Redirect(w, r, "/account/password/update", http.StatusSeeOther)
+			return
+		}
 		// require authentication are not stored in the users browser cache (or
 		// other intermediary cache).
 		w.Header().Add("Cache-Control", "no-store")
@@ -70,14 +70,31 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireRole() returns a middleware that only lets users with the given role
+// through. Use it after requireAuthentication in a chain.
+func (app *application) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := app.authenticatedUser(r)
+			if user == nil || user.Role != role {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // NoSurf() middleware uses a customized CSRF cookie with
-// the Secure, Path, and HttpOnly attributes set.
-func noSurf(next http.Handler) http.Handler {
+// the Path and HttpOnly attributes set, and Secure unless cookies may be sent
+// over plain HTTP.
+func (app *application) noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path:     "/",
-		Secure:   true,
+		Secure:   app.secureCookies,
 	})
 
 	return csrfHandler
@@ -93,18 +110,48 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		exists, err := app.users.Exists(id)
-		if err != nil {
-			app.serverError(w, err)
+		user, err := app.users.Get(r.Context(), id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
 			return
 		}
-		// If user exists, create new request context key
-		if exists {
+		// If user exists and may log in, create new request context keys
+		if err == nil && !user.Disabled {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, authenticatedUserContextKey, user)
 			r = r.WithContext(ctx)
+			setLoggedUser(ctx, user.ID)
+
+			err = app.touchSession(r)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
 		}
 
 		// Call the next handler in the chain
 		next.ServeHTTP(w, r)
 	})
 }
+
+// readYourWrites keeps the reads of a user who just submitted a change on the
+// primary database for app.primaryWindow, so that the page they are redirected
+// to doesn't come from a replica which hasn't caught up yet. Any request which
+// isn't a GET or HEAD is taken to be a change.
+func (app *application) readYourWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.primaryWindow == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			app.sessionManager.Put(r.Context(), "primaryUntil", time.Now().Add(app.primaryWindow))
+			r = r.WithContext(models.WithPrimary(r.Context()))
+		} else if time.Now().Before(app.sessionManager.GetTime(r.Context(), "primaryUntil")) {
+			r = r.WithContext(models.WithPrimary(r.Context()))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/minhnghia2k3/snippet_box/internal/migrations"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+)
+
+const migrateUsage = "usage: web [flags] migrate up | down [n] | status"
+
+// The runMigrate() function implements the "migrate" subcommand, writing what
+// it did to w.
+func runMigrate(db *models.DB, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Fprintf(w, "applied %s\n", mig)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(w, "schema is up to date")
+		}
+		return err
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("migrate down: %q is not a positive number", args[1])
+			}
+		}
+
+		reverted, err := m.Down(ctx, n)
+		for _, mig := range reverted {
+			fmt.Fprintf(w, "reverted %s\n", mig)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Fprintln(w, "no migrations to revert")
+		}
+		return err
+
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = "applied " + s.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%-40s %s\n", s.Migration, applied)
+		}
+		return nil
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// The autoMigrate() function brings the database up to the current schema
+// before the server starts.
+func autoMigrate(db *models.DB, logger *slog.Logger) error {
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.Up(context.Background())
+	for _, mig := range applied {
+		logger.Info("applied migration", "migration", mig.String())
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// The parseTrustedProxies() function parses the addresses of trusted reverse
+// proxies, each a CIDR prefix such as 10.0.0.0/8 or a single IP address.
+func parseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR prefix", v)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR prefix", v)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Reports whether addr belongs to a trusted reverse proxy.
+func (app *application) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// The proxyHeaders() middleware honours the X-Forwarded-For and
+// X-Forwarded-Proto headers of requests from trusted proxies, and only those:
+// anyone else could send them to spoof their address.
+//
+// The client is the right-most address in X-Forwarded-For which isn't a
+// trusted proxy, since proxies append the address they received the request
+// from. It replaces r.RemoteAddr, so that logs, login throttling and sessions
+// all see it.
+//
+// With secure cookies, which browsers only send over HTTPS, requests which the
+// proxy received over plain HTTP are redirected to HTTPS.
+func (app *application) proxyHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !app.isTrustedProxy(peer.Addr()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if client, ok := app.forwardedFor(r); ok {
+			r.RemoteAddr = netip.AddrPortFrom(client, 0).String()
+		}
+
+		proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		if app.secureCookies && strings.EqualFold(strings.TrimSpace(proto), "http") {
+			http.Redirect(w, r, httpsURL(r, ""), http.StatusPermanentRedirect)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returns the client address from the X-Forwarded-For headers of r.
+func (app *application) forwardedFor(r *http.Request) (netip.Addr, bool) {
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !app.isTrustedProxy(client) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+// The redirectToHTTPS() handler redirects every request to the same URL over
+// HTTPS, on the port of httpsAddr.
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, httpsURL(r, port), http.StatusPermanentRedirect)
+	})
+}
+
+// Returns the HTTPS URL of r on the given port, or the default port when it is
+// empty or 443.
+func httpsURL(r *http.Request, port string) string {
+	u := url.URL{Scheme: "https", Host: r.Host}
+	host := u.Hostname()
+	if port != "" && port != "443" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+	return u.String() + r.URL.RequestURI()
+}
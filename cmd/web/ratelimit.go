@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimit allows a burst of requests, refilled evenly over the period: 10/1m
+// allows 10 requests at once, then one every 6 seconds. The zero value allows
+// everything.
+type rateLimit struct {
+	requests int
+	per      time.Duration
+}
+
+// String formats the limit the way Set parses it.
+func (l *rateLimit) String() string {
+	if l.requests == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.requests, l.per)
+}
+
+// Set parses a limit such as "10/1m", or "off".
+func (l *rateLimit) Set(value string) error {
+	if value == "off" {
+		*l = rateLimit{}
+		return nil
+	}
+
+	requests, per, ok := strings.Cut(value, "/")
+	if !ok {
+		return errors.New(`must be of the form requests/period, such as 10/1m, or "off"`)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return errors.New("the number of requests must be a positive integer")
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return errors.New("the period must be a positive duration")
+	}
+
+	*l = rateLimit{requests: n, per: d}
+	return nil
+}
+
+func (l *rateLimit) Get() any {
+	return l.String()
+}
+
+// take refills a bucket last updated with tokens left, and takes a token from
+// it if there is one. It returns the tokens left now, and how long to wait
+// for a token when there was none.
+func (l rateLimit) take(tokens float64, last, now time.Time) (float64, time.Duration) {
+	rate := float64(l.requests) / l.per.Seconds()
+	tokens = min(tokens+now.Sub(last).Seconds()*rate, float64(l.requests))
+
+	if tokens < 1 {
+		return tokens, time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return tokens - 1, 0
+}
+
+// rateLimitStore keeps the token buckets of the rate limits, by key.
+type rateLimitStore interface {
+	// take takes a token from the bucket for key, returning how long to wait
+	// for one when the bucket is empty.
+	take(ctx context.Context, key string, limit rateLimit) (time.Duration, error)
+}
+
+// memoryRateStore keeps the buckets in memory, so each server enforces its own
+// limits.
+type memoryRateStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*models.RateLimitBucket
+	lastSweep time.Time
+}
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{buckets: make(map[string]*models.RateLimitBucket)}
+}
+
+func (s *memoryRateStore) take(ctx context.Context, key string, limit rateLimit) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &models.RateLimitBucket{Key: key, Tokens: float64(limit.requests), Updated: now}
+		s.buckets[key] = b
+	}
+
+	var wait time.Duration
+	b.Tokens, wait = limit.take(b.Tokens, b.Updated, now)
+	b.Updated = now
+	return wait, nil
+}
+
+// sweep drops the buckets which haven't been used for an hour, at most once a
+// minute. Limits with longer periods forget about quiet clients sooner than
+// they should. The caller must hold s.mu.
+func (s *memoryRateStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.Sub(b.Updated) > time.Hour {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// dbRateStore keeps the buckets in the database, so the limits hold across
+// every server sharing it.
+type dbRateStore struct {
+	model *models.RateLimitModel
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// How many times a bucket updated concurrently by other servers is read
+// again before giving up.
+const rateStoreRetries = 5
+
+func (s *dbRateStore) take(ctx context.Context, key string, limit rateLimit) (time.Duration, error) {
+	s.sweep(ctx)
+
+	for range rateStoreRetries {
+		now := time.Now()
+
+		old, err := s.model.Get(ctx, key)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			return 0, err
+		}
+
+		b := &models.RateLimitBucket{Key: key, Tokens: float64(limit.requests), Updated: now}
+		if old != nil {
+			b.Tokens, b.Updated = old.Tokens, old.Updated
+		}
+
+		var wait time.Duration
+		b.Tokens, wait = limit.take(b.Tokens, b.Updated, now)
+		b.Updated = now
+
+		ok, err := s.model.Put(ctx, b, old)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return wait, nil
+		}
+	}
+
+	return 0, fmt.Errorf("rate limit bucket %q: too much contention", key)
+}
+
+// sweep deletes the buckets which haven't been used for a day, at most once an
+// hour.
+func (s *dbRateStore) sweep(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) < time.Hour {
+		return
+	}
+	s.lastSweep = now
+
+	// Stale buckets only take up space, so a failure can wait for next time.
+	s.model.DeleteStale(ctx, now.Add(-24*time.Hour))
+}
+
+// The rateLimit() middleware limits the requests going through it to limit,
+// per authenticated user or else per client IP. Limits are named, so that
+// each keeps buckets of its own. Requests over the limit get 429 Too Many
+// Requests with a Retry-After header. When the store fails, requests are let
+// through rather than locking everyone out.
+func (app *application) rateLimit(name string, limit rateLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.requests == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := name + ":ip:" + app.clientIP(r)
+			if user := app.authenticatedUser(r); user != nil {
+				key = name + ":user:" + strconv.Itoa(user.ID)
+			}
+
+			wait, err := app.rateLimits.take(r.Context(), key, limit)
+			if err != nil {
+				app.requestLogger(r).Warn("rate limit unavailable", "limit", name, "error", err)
+			}
+
+			if wait > 0 {
+				app.metrics.rateLimited(name)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				app.clientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
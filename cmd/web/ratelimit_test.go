@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  rateLimit
+		err   bool
+	}{
+		{"10/1m", rateLimit{10, time.Minute}, false},
+		{"off", rateLimit{}, false},
+		{"10", rateLimit{}, true},
+		{"0/1m", rateLimit{}, true},
+		{"10/0s", rateLimit{}, true},
+		{"ten/1m", rateLimit{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var l rateLimit
+			err := l.Set(tt.value)
+			assert.Equal(t, err != nil, tt.err)
+			assert.Equal(t, l, tt.want)
+		})
+	}
+}
+
+func TestRateLimitTake(t *testing.T) {
+	limit := rateLimit{requests: 2, per: time.Minute}
+	start := time.Now()
+
+	tokens, wait := limit.take(2, start, start)
+	assert.Equal(t, wait, time.Duration(0))
+	tokens, wait = limit.take(tokens, start, start)
+	assert.Equal(t, wait, time.Duration(0))
+
+	// The bucket is empty, and refills a token every 30 seconds.
+	_, wait = limit.take(tokens, start, start)
+	assert.Equal(t, wait, 30*time.Second)
+	_, wait = limit.take(tokens, start, start.Add(20*time.Second))
+	assert.Equal(t, wait.Round(time.Second), 10*time.Second)
+	_, wait = limit.take(tokens, start, start.Add(30*time.Second))
+	assert.Equal(t, wait, time.Duration(0))
+
+	// A bucket never holds more than the burst.
+	tokens, _ = limit.take(0, start, start.Add(time.Hour))
+	assert.Equal(t, tokens, 1.0)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	app := newTestApplication(t)
+	h := app.rateLimit("test", rateLimit{requests: 2, per: time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+
+	serve := func(remoteAddr string, user *models.User) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = remoteAddr
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), authenticatedUserContextKey, user))
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+
+	assert.Equal(t, serve("203.0.113.7:5000", nil).Code, http.StatusOK)
+	assert.Equal(t, serve("203.0.113.7:5001", nil).Code, http.StatusOK)
+
+	rr := serve("203.0.113.7:5002", nil)
+	assert.Equal(t, rr.Code, http.StatusTooManyRequests)
+	assert.Equal(t, rr.Header().Get("Retry-After"), "1800")
+
+	// Other clients have buckets of their own, and so do users whatever their
+	// IP.
+	assert.Equal(t, serve("198.51.100.1:5000", nil).Code, http.StatusOK)
+	assert.Equal(t, serve("203.0.113.7:5003", &models.User{ID: 1}).Code, http.StatusOK)
+	assert.Equal(t, serve("203.0.113.7:5004", &models.User{ID: 1}).Code, http.StatusOK)
+	assert.Equal(t, serve("198.51.100.1:5001", &models.User{ID: 1}).Code, http.StatusTooManyRequests)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/minhnghia2k3/snippet_box/internal/models"
 	"github.com/minhnghia2k3/snippet_box/ui"
 	"net/http"
 
@@ -10,38 +11,105 @@ import (
 
 // The routes() method returns a servemux containing our application routes.
 func (app *application) routes() http.Handler {
-	router := httprouter.New()
+	// Handlers are registered through measuredRouter, so that requests are
+	// measured and traced by the route pattern they matched.
+	router := measuredRouter{httprouter.New()}
 
 	// Handle 404 not found page.
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if redirectUserFeed(w, r) {
+			return
+		}
 		app.notFound(w)
 	})
 
 	fileServer := http.FileServer(http.FS(ui.Files))
 	router.Handler(http.MethodGet, "/static/*filepath", fileServer)
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.noSurf, app.authenticate, app.readYourWrites)
 	protected := dynamic.Append(app.requireAuthentication)
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+	// Raw snippets have no forms, so they go without CSRF protection and the
+	// cookie it sets, which would keep shared caches from storing them.
+	raw := alice.New(app.sessionManager.LoadAndSave, app.authenticate, app.readYourWrites)
+	// Requests which create things are rate limited, per user or else per
+	// client IP.
+	signup := dynamic.Append(app.rateLimit("signup", app.signupLimit))
+	write := protected.Append(app.rateLimit("write", app.writeLimit))
 	router.HandlerFunc(http.MethodGet, "/ping", ping)
+	router.HandlerFunc(http.MethodGet, "/healthz", app.healthz)
+	router.HandlerFunc(http.MethodGet, "/readyz", app.readyz)
+
+	// The API authenticates requests with personal tokens rather than
+	// sessions, so it goes without them and without CSRF protection.
+	api := alice.New(app.authenticateToken)
+	apiWrite := api.Append(app.rateLimit("write", app.writeLimit))
+	router.Handler(http.MethodGet, "/api/snippets", api.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodPost, "/api/snippets", apiWrite.ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodGet, "/api/snippets/:id", api.ThenFunc(app.apiSnippetGet))
+	router.Handler(http.MethodDelete, "/api/snippets/:id", api.ThenFunc(app.apiSnippetDelete))
+
+	// Feeds are the same for everyone, so they go without sessions.
+	router.HandlerFunc(http.MethodGet, "/feed.atom", app.latestFeed)
+	router.HandlerFunc(http.MethodGet, "/users/:id/feed.atom", app.userFeed)
 
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
 	router.Handler(http.MethodGet, "/about", dynamic.ThenFunc(app.about))
 	router.Handler(http.MethodGet, "/account/view", protected.ThenFunc(app.accountView))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/snippet/raw/:id", raw.ThenFunc(app.snippetRaw))
 	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodPost, "/snippet/create", write.ThenFunc(app.snippetCreatePost))
 
 	// Authentication
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
-	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
+	router.Handler(http.MethodPost, "/user/signup", signup.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
 	router.Handler(http.MethodGet, "/account/password/update", protected.ThenFunc(app.updatePassword))
 	router.Handler(http.MethodPost, "/account/password/update", protected.ThenFunc(app.updatePasswordPost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodGet, "/account/profile/update", protected.ThenFunc(app.accountProfileUpdate))
+	router.Handler(http.MethodPost, "/account/profile/update", protected.ThenFunc(app.accountProfileUpdatePost))
+	router.Handler(http.MethodGet, "/account/email/confirm/:token", dynamic.ThenFunc(app.accountEmailConfirm))
+	router.Handler(http.MethodGet, "/account/delete", protected.ThenFunc(app.accountDelete))
+	router.Handler(http.MethodPost, "/account/delete", protected.ThenFunc(app.accountDeletePost))
+	router.Handler(http.MethodGet, "/account/sessions", protected.ThenFunc(app.accountSessions))
+	router.Handler(http.MethodGet, "/account/security", protected.ThenFunc(app.accountSecurity))
+	router.Handler(http.MethodPost, "/account/sessions/revoke", protected.ThenFunc(app.accountSessionRevokePost))
+	router.Handler(http.MethodPost, "/account/sessions/revoke-others", protected.ThenFunc(app.accountSessionsRevokeOthersPost))
+
+	// Personal tokens
+	router.Handler(http.MethodGet, "/account/tokens", protected.ThenFunc(app.accountTokens))
+	router.Handler(http.MethodPost, "/account/tokens", protected.ThenFunc(app.accountTokenCreatePost))
+	router.Handler(http.MethodPost, "/account/tokens/revoke", protected.ThenFunc(app.accountTokensRevokePost))
+
+	// Webhooks
+	router.Handler(http.MethodGet, "/account/webhooks", protected.ThenFunc(app.webhookList))
+	router.Handler(http.MethodPost, "/account/webhooks", write.ThenFunc(app.webhookCreatePost))
+	router.Handler(http.MethodGet, "/account/webhooks/:id", protected.ThenFunc(app.webhookView))
+	router.Handler(http.MethodPost, "/account/webhooks/:id/delete", protected.ThenFunc(app.webhookDeletePost))
+	router.Handler(http.MethodPost, "/account/webhooks/:id/redeliver", protected.ThenFunc(app.webhookRedeliverPost))
+
+	// Organizations
+	router.Handler(http.MethodGet, "/org", protected.ThenFunc(app.orgList))
+	router.Handler(http.MethodGet, "/org/create", protected.ThenFunc(app.orgCreate))
+	router.Handler(http.MethodPost, "/org/create", write.ThenFunc(app.orgCreatePost))
+	router.Handler(http.MethodGet, "/org/view/:id", protected.ThenFunc(app.orgView))
+	router.Handler(http.MethodPost, "/org/members/:id", protected.ThenFunc(app.orgMemberAddPost))
+	router.Handler(http.MethodPost, "/org/members/:id/remove", protected.ThenFunc(app.orgMemberRemovePost))
+
+	// Administration
+	router.Handler(http.MethodGet, "/admin", admin.ThenFunc(app.adminUsers))
+	router.Handler(http.MethodPost, "/admin/users/:id/disable", admin.ThenFunc(app.adminUserDisablePost))
+	router.Handler(http.MethodPost, "/admin/users/:id/enable", admin.ThenFunc(app.adminUserEnablePost))
+	router.Handler(http.MethodPost, "/admin/users/:id/reset-password", admin.ThenFunc(app.adminUserResetPasswordPost))
+	router.Handler(http.MethodPost, "/admin/snippets/:id/delete", admin.ThenFunc(app.adminSnippetDeletePost))
+	router.Handler(http.MethodGet, "/admin/audit", admin.ThenFunc(app.adminAudit))
+	router.Handler(http.MethodGet, "/admin/audit/export", admin.ThenFunc(app.adminAuditExport))
 
 	// standard middleware chain - which will be used for every request.
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeader)
+	standard := alice.New(traceRequest, app.requestID, app.proxyHeaders, app.logRequest, app.recoverPanic, secureHeader)
 
-	return standard.Then(router)
+	return standard.Then(router.Router)
 }
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Environment variables through which a restarting server hands its listeners
+// to the new process, and the new process says it is ready to take over.
+const (
+	listenFDsEnv = "SNIPPETBOX_LISTEN_FDS"
+	readyFDEnv   = "SNIPPETBOX_READY_FD"
+)
+
+// How long a restarting server waits for its replacement to be ready.
+const restartTimeout = 30 * time.Second
+
+// The listen() function returns a listener for each of addrs, in order. They
+// are, in order of preference:
+//
+//   - the sockets passed by systemd socket activation (LISTEN_PID, LISTEN_FDS),
+//   - the sockets handed over by a server restarting on SIGHUP, or
+//   - new sockets listening on addrs.
+func listen(addrs ...string) ([]net.Listener, error) {
+	var fds []uintptr
+
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if n != len(addrs) {
+			return nil, fmt.Errorf("expected %d sockets from systemd, got LISTEN_FDS=%q", len(addrs), os.Getenv("LISTEN_FDS"))
+		}
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		// systemd passes sockets from fd 3 onwards.
+		for i := range addrs {
+			fds = append(fds, uintptr(3+i))
+		}
+	} else if s := os.Getenv(listenFDsEnv); s != "" {
+		os.Unsetenv(listenFDsEnv)
+		for _, v := range strings.Split(s, ",") {
+			fd, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", listenFDsEnv, err)
+			}
+			fds = append(fds, uintptr(fd))
+		}
+		if len(fds) != len(addrs) {
+			return nil, fmt.Errorf("expected %d inherited sockets, got %s=%q", len(addrs), listenFDsEnv, s)
+		}
+	}
+
+	var lns []net.Listener
+	for i, addr := range addrs {
+		var ln net.Listener
+		var err error
+		if fds != nil {
+			ln, err = fileListener(fds[i], addr)
+		} else {
+			ln, err = net.Listen("tcp", addr)
+		}
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	defer f.Close()
+
+	// FileListener duplicates the descriptor, so f can be closed.
+	return net.FileListener(f)
+}
+
+// The serve() method serves each of srvs on the listener at the same index of
+// lns, until the process is told to stop. Servers with a TLSConfig serve HTTPS
+// with its certificates, the others plain HTTP.
+//
+// SIGINT and SIGTERM shut the servers down gracefully: /readyz fails for the
+// shutdown delay, then they stop accepting connections, wait up to drain for
+// in-flight requests and then for background tasks. SIGHUP first starts a new
+// copy of the server on the same sockets, and shuts this one down once the
+// copy is ready, so that no connection is refused during the restart.
+func (app *application) serve(srvs []*http.Server, lns []net.Listener, drain time.Duration) error {
+	shutdownError := make(chan error, 1)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for s := range signals {
+			if s == syscall.SIGHUP {
+				app.logger.Info("restarting")
+				err := restart(lns)
+				if err != nil {
+					app.logger.Error("restart failed, still serving", "error", err)
+					continue
+				}
+			}
+
+			app.shuttingDown.Store(true)
+			if s != syscall.SIGHUP && app.shutdownDelay > 0 {
+				app.logger.Info("not ready, waiting before shutting down", "delay", app.shutdownDelay)
+				time.Sleep(app.shutdownDelay)
+			}
+
+			app.logger.Info("shutting down", "signal", s.String(), "drain", drain)
+
+			ctx, cancel := context.WithTimeout(context.Background(), drain)
+			var errs []error
+			for _, srv := range srvs {
+				errs = append(errs, srv.Shutdown(ctx))
+			}
+			cancel()
+
+			// Let the emails and other background tasks finish too.
+			app.wg.Wait()
+
+			shutdownError <- errors.Join(errs...)
+			return
+		}
+	}()
+
+	err := notifyReady()
+	if err != nil {
+		return err
+	}
+
+	serveErrors := make(chan error, len(srvs))
+	for i, srv := range srvs {
+		go func() {
+			if srv.TLSConfig != nil {
+				serveErrors <- srv.ServeTLS(lns[i], "", "")
+			} else {
+				serveErrors <- srv.Serve(lns[i])
+			}
+		}()
+	}
+
+	for range srvs {
+		err := <-serveErrors
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("server stopped")
+	return nil
+}
+
+// The restart() function starts a new copy of the server, with the same
+// arguments, handing it the listening sockets. It returns once the new process
+// is ready to serve.
+func restart(lns []net.Listener) error {
+	// ExtraFiles become fds 3, 4... in the new process.
+	var files []*os.File
+	var fds []string
+	for _, ln := range lns {
+		tcpListener, ok := ln.(*net.TCPListener)
+		if !ok {
+			return fmt.Errorf("can't hand over a %T", ln)
+		}
+
+		f, err := tcpListener.File()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		files = append(files, f)
+		fds = append(fds, strconv.Itoa(3+len(fds)))
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyWriter.Close()
+		return err
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		listenFDsEnv+"="+strings.Join(fds, ","),
+		readyFDEnv+"="+strconv.Itoa(3+len(files)))
+	cmd.ExtraFiles = append(files, readyWriter)
+
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	// The new process writes "ready" once it is about to serve. If it exits
+	// before then, the pipe is closed without it.
+	ready.SetReadDeadline(time.Now().Add(restartTimeout))
+	msg, err := io.ReadAll(io.LimitReader(ready, 16))
+	if string(msg) != "ready" {
+		cmd.Process.Kill()
+		if err == nil {
+			err = errors.New("new process exited before it was ready")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// The notifyReady() function tells the server which started this process with
+// restart(), if any, that it can shut down.
+func notifyReady() error {
+	s := os.Getenv(readyFDEnv)
+	if s == "" {
+		return nil
+	}
+	os.Unsetenv(readyFDEnv)
+
+	fd, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%s: %w", readyFDEnv, err)
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+
+	_, err = f.Write([]byte("ready"))
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListenInherited(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// listen() takes ownership of the descriptor it is given.
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(listenFDsEnv, strconv.Itoa(fd))
+
+	lns, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lns[0].Close()
+
+	assert.Equal(t, lns[0].Addr().String(), parent.Addr().String())
+	assert.Equal(t, os.Getenv(listenFDsEnv), "")
+}
+
+func TestServeShutdown(t *testing.T) {
+	app := newTestApplication(t)
+
+	started := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	// Borrow the test certificate of an httptest server.
+	ts := httptest.NewTLSServer(slow)
+	client := ts.Client()
+	srv := &http.Server{Handler: slow, TLSConfig: ts.TLS.Clone()}
+	ts.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- app.serve([]*http.Server{srv}, []net.Listener{ln}, 5*time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		rs, err := client.Get("https://" + ln.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer rs.Body.Close()
+		body, err := io.ReadAll(rs.Body)
+		responses <- result{string(body), err}
+	}()
+
+	// SIGTERM while the request is in flight; it should still complete.
+	<-started
+	err = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := <-responses
+	assert.Equal(t, rs.err, nil)
+	assert.Equal(t, rs.body, "done")
+
+	select {
+	case err := <-served:
+		assert.Equal(t, err, nil)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+
+	_, err = net.Dial("tcp", ln.Addr().String())
+	if err == nil {
+		t.Error("server still accepting connections")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// How often the last-seen time of a session is refreshed. Updating it on every
+// request would mean a session store write per request.
+const sessionTouchInterval = time.Minute
+
+// Session values are gob encoded, and gob needs to know about any concrete
+// type stored behind an interface.
+func init() {
+	gob.Register(time.Time{})
+}
+
+// sessionInfo describes one of a user's active sessions for the sessions page.
+type sessionInfo struct {
+	ID        string
+	Created   time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+	Current   bool
+}
+
+// startSession records the metadata shown on the sessions page. It must be
+// called after the user is authenticated and the token has been renewed.
+func (app *application) startSession(r *http.Request) error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	app.sessionManager.Put(r.Context(), "sessionID", id)
+	app.sessionManager.Put(r.Context(), "sessionCreated", now)
+	app.sessionManager.Put(r.Context(), "sessionLastSeen", now)
+	app.sessionManager.Put(r.Context(), "sessionIP", app.clientIP(r))
+	app.sessionManager.Put(r.Context(), "sessionUserAgent", r.UserAgent())
+	return nil
+}
+
+// touchSession refreshes the last-seen time and IP of an authenticated
+// session, at most once per sessionTouchInterval. Sessions created before the
+// metadata existed are given an ID on first sight.
+func (app *application) touchSession(r *http.Request) error {
+	if app.sessionManager.GetString(r.Context(), "sessionID") == "" {
+		return app.startSession(r)
+	}
+
+	lastSeen := app.sessionManager.GetTime(r.Context(), "sessionLastSeen")
+	if time.Since(lastSeen) < sessionTouchInterval {
+		return nil
+	}
+
+	app.sessionManager.Put(r.Context(), "sessionLastSeen", time.Now())
+	app.sessionManager.Put(r.Context(), "sessionIP", app.clientIP(r))
+	app.sessionManager.Put(r.Context(), "sessionUserAgent", r.UserAgent())
+	return nil
+}
+
+// userSessions returns the active sessions belonging to userID, most recently
+// used first, with the session making the request marked as current.
+//
+// The session store has no index by user, so this walks every session.
+func (app *application) userSessions(r *http.Request, userID int) ([]*sessionInfo, error) {
+	// The current session is taken from the request rather than the store: its
+	// token may have just been renewed and not yet been committed.
+	current := app.sessionInfo(r.Context())
+	current.Current = true
+	sessions := []*sessionInfo{current}
+
+	err := app.sessionManager.Iterate(r.Context(), func(ctx context.Context) error {
+		if app.sessionManager.GetInt(ctx, "authenticatedUserID") != userID {
+			return nil
+		}
+
+		s := app.sessionInfo(ctx)
+		if s.ID != current.ID {
+			sessions = append(sessions, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
+
+func (app *application) sessionInfo(ctx context.Context) *sessionInfo {
+	return &sessionInfo{
+		ID:        app.sessionManager.GetString(ctx, "sessionID"),
+		Created:   app.sessionManager.GetTime(ctx, "sessionCreated"),
+		LastSeen:  app.sessionManager.GetTime(ctx, "sessionLastSeen"),
+		IP:        app.sessionManager.GetString(ctx, "sessionIP"),
+		UserAgent: app.sessionManager.GetString(ctx, "sessionUserAgent"),
+	}
+}
+
+// destroyUserSessions destroys the sessions of userID for which match returns
+// true, and reports how many were destroyed.
+func (app *application) destroyUserSessions(ctx context.Context, userID int, match func(id string) bool) (int, error) {
+	return destroySessions(ctx, app.sessionManager, userID, match)
+}
+
+// The destroySessions() function does the work of destroyUserSessions() for
+// any session manager, including the one of the admin commands.
+func destroySessions(ctx context.Context, sessionManager *scs.SessionManager, userID int, match func(id string) bool) (int, error) {
+	destroyed := 0
+
+	err := sessionManager.Iterate(ctx, func(ctx context.Context) error {
+		if sessionManager.GetInt(ctx, "authenticatedUserID") != userID {
+			return nil
+		}
+		if !match(sessionManager.GetString(ctx, "sessionID")) {
+			return nil
+		}
+
+		destroyed++
+		return sessionManager.Destroy(ctx)
+	})
+
+	return destroyed, err
+}
+
+// destroyOtherSessions signs userID out everywhere except the session making
+// the request.
+func (app *application) destroyOtherSessions(r *http.Request, userID int) (int, error) {
+	currentID := app.sessionManager.GetString(r.Context(), "sessionID")
+
+	return app.destroyUserSessions(r.Context(), userID, func(id string) bool {
+		return id != currentID
+	})
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
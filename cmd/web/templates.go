@@ -16,9 +16,20 @@ type templateData struct {
 	Snippet         *models.Snippet
 	Snippets        []*models.Snippet
 	User            *models.User
+	Users           []*models.User
+	Sessions        []*sessionInfo
+	Organization    *models.Organization
+	Organizations   []*models.Organization
+	Members         []*models.OrganizationMember
+	AuditEvents     []*models.AuditEvent
+	Webhook         *models.Webhook
+	Webhooks        []*models.Webhook
+	Deliveries      []*models.WebhookDelivery
+	Token           *models.Token
 	Form            any
 	Flash           string
 	IsAuthenticated bool
+	IsAdmin         bool
 	CSRFToken       string
 }
 
@@ -4,15 +4,17 @@ import (
 	"bytes"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/minhnghia2k3/snippet_box/internal/mailer"
 	"github.com/minhnghia2k3/snippet_box/internal/models/mocks"
 	"html"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,13 +33,22 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Cookie.Secure = true
 
 	return &application{
-		errorLog:       log.New(io.Discard, "", 0),
-		infoLog:        log.New(io.Discard, "", 0),
-		snippets:       &mocks.SnippetModel{},
-		users:          &mocks.UserModel{},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+		logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		snippets:        &mocks.SnippetModel{},
+		users:           &mocks.UserModel{},
+		tokens:          &mocks.TokenModel{},
+		organizations:   &mocks.OrganizationModel{},
+		auditLog:        &mocks.AuditModel{},
+		webhooks:        &mocks.WebhookModel{},
+		templateCache:   templateCache,
+		formDecoder:     formDecoder,
+		sessionManager:  sessionManager,
+		mailer:          mailer.New("", 0, "", "", "", slog.New(slog.NewTextHandler(io.Discard, nil))),
+		accountThrottle: newLoginThrottle(5, 30*time.Second, 30*time.Minute, time.Hour),
+		ipThrottle:      newLoginThrottle(20, 30*time.Second, 30*time.Minute, time.Hour),
+		secureCookies:   true,
+		rateLimits:      newMemoryRateStore(),
+		baseURL:         "https://snippetbox.example.com",
 	}
 }
 
@@ -82,6 +93,50 @@ func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, strin
 	return rs.StatusCode, rs.Header, string(body)
 }
 
+// getWithHeaders is like get(), but sends the given request headers.
+func (ts *testServer) getWithHeaders(t *testing.T, urlPath string, header http.Header) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+// request sends a request with any method, headers and body.
+func (ts *testServer) request(t *testing.T, method, urlPath string, header http.Header, body string) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(respBody)
+}
+
 var csrfTokenRx = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+)'/>`)
 
 func extractCSRFToken(t *testing.T, body string) string {
@@ -110,3 +165,35 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// login signs the test client in as the mock user with the given email and
+// returns a CSRF token that can be used for further form submissions.
+func (ts *testServer) login(t *testing.T, email string) string {
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", csrfToken)
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+
+	return csrfToken
+}
+
+// resetClient gives the test client an empty cookie jar, so that it acts like
+// a different browser.
+func (ts *testServer) resetClient(t *testing.T) http.CookieJar {
+	old := ts.Client().Jar
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	return old
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// loginThrottle counts failed login attempts per key (an account or a client
+// IP) and locks the key out with an exponentially growing delay once the
+// allowance of free failures has been used up.
+type loginThrottle struct {
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+
+	free   int           // failures allowed before lockouts start
+	base   time.Duration // length of the first lockout
+	max    time.Duration // upper bound for a single lockout
+	window time.Duration // quiet period after which failures are forgotten
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newLoginThrottle(free int, base, max, window time.Duration) *loginThrottle {
+	return &loginThrottle{
+		attempts: make(map[string]*loginAttempts),
+		free:     free,
+		base:     base,
+		max:      max,
+		window:   window,
+	}
+}
+
+// lockedFor returns how much longer the key is locked out, or zero if a login
+// attempt may go ahead.
+func (t *loginThrottle) lockedFor(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, ok := t.attempts[key]
+	if !ok {
+		return 0
+	}
+
+	if d := time.Until(a.lockedUntil); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// fail records a failed attempt for key, extends its lockout if the free
+// allowance is exhausted and returns the number of consecutive failures.
+func (t *loginThrottle) fail(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweep(now)
+
+	a, ok := t.attempts[key]
+	if !ok || now.Sub(a.lastFailure) > t.window {
+		a = &loginAttempts{}
+		t.attempts[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+
+	if a.failures >= t.free {
+		// Double the lockout for every failure past the allowance. The shift is
+		// capped so the duration can't overflow before hitting t.max.
+		shift := min(a.failures-t.free, 20)
+		lockout := min(t.base<<shift, t.max)
+		a.lockedUntil = now.Add(lockout)
+	}
+
+	return a.failures
+}
+
+// reset forgets all failures recorded for key.
+func (t *loginThrottle) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+}
+
+// sweep drops entries that have been quiet for longer than the window, at most
+// once a minute. The caller must hold t.mu.
+func (t *loginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+
+	for key, a := range t.attempts {
+		if now.Sub(a.lastFailure) > t.window && now.After(a.lockedUntil) {
+			delete(t.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := newLoginThrottle(3, time.Minute, 5*time.Minute, time.Hour)
+
+	// The free failures don't lock the key out.
+	for i := 1; i < 3; i++ {
+		assert.Equal(t, throttle.fail("alice"), i)
+		assert.Equal(t, throttle.lockedFor("alice"), time.Duration(0))
+	}
+
+	// The third failure locks for the base duration...
+	throttle.fail("alice")
+	locked := throttle.lockedFor("alice")
+	assert.Equal(t, locked > 0 && locked <= time.Minute, true)
+
+	// ...and every further failure doubles it, up to the maximum.
+	throttle.fail("alice")
+	locked = throttle.lockedFor("alice")
+	assert.Equal(t, locked > time.Minute && locked <= 2*time.Minute, true)
+
+	for i := 0; i < 10; i++ {
+		throttle.fail("alice")
+	}
+	locked = throttle.lockedFor("alice")
+	assert.Equal(t, locked > 4*time.Minute && locked <= 5*time.Minute, true)
+
+	// Other keys are unaffected, and reset clears the lockout.
+	assert.Equal(t, throttle.lockedFor("bob"), time.Duration(0))
+	throttle.reset("alice")
+	assert.Equal(t, throttle.lockedFor("alice"), time.Duration(0))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Spans are started with the global tracer provider, which does nothing until
+// main() installs one.
+var tracer = otel.Tracer("github.com/minhnghia2k3/snippet_box/cmd/web")
+
+// The newTracerProvider() function returns a tracer provider exporting spans
+// over OTLP/HTTP to endpoint, a URL such as http://localhost:4318, and
+// sampling the given ratio of the traces which don't come with a sampling
+// decision of their own.
+func newTracerProvider(ctx context.Context, endpoint string, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("snippetbox")))
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	), nil
+}
+
+// The traceRequest() middleware starts a span for each request, continuing
+// the trace of the caller when the request carries a W3C traceparent header.
+// The span is named after the method until the router finds the route.
+func traceRequest(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.request",
+		otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})),
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
+
+// Names the request span of ctx after the route pattern it matched.
+func setSpanRoute(ctx context.Context, method, route string) {
+	span := trace.SpanFromContext(ctx)
+	span.SetName(method + " " + route)
+	span.SetAttributes(semconv.HTTPRoute(route))
+}
+
+// The traceModels() method wraps the models of app so that every call to
+// them is traced.
+func (app *application) traceModels() {
+	app.snippets = &models.TracedSnippetModel{SnippetModelInterface: app.snippets}
+	app.users = &models.TracedUserModel{UserModelInterface: app.users}
+	app.tokens = &models.TracedTokenModel{TokenModelInterface: app.tokens}
+	app.organizations = &models.TracedOrganizationModel{OrganizationModelInterface: app.organizations}
+	app.auditLog = &models.TracedAuditModel{AuditModelInterface: app.auditLog}
+	app.webhooks = &models.TracedWebhookModel{WebhookModelInterface: app.webhooks}
+}
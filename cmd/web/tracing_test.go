@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	app := newTestApplication(t)
+	app.traceModels()
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The caller's trace is continued.
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	code, _, _ := ts.getWithHeaders(t, "/snippet/view/1", header)
+	assert.Equal(t, code, http.StatusOK)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	request, ok := spans["GET /snippet/view/:id"]
+	if !ok {
+		t.Fatalf("no request span in %v", spans)
+	}
+	assert.Equal(t, request.SpanContext().TraceID().String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, request.Parent().SpanID().String(), "00f067aa0ba902b7")
+
+	for _, name := range []string{"SnippetModel.Get", "render view.tmpl"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("no %q span", name)
+			continue
+		}
+		assert.Equal(t, span.Parent().SpanID(), request.SpanContext().SpanID())
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Events sent to webhooks. The tree has no snippet editing or comments yet;
+// their events will be "snippet.updated" and "snippet.commented".
+const (
+	webhookSnippetCreated = "snippet.created"
+	webhookSnippetDeleted = "snippet.deleted"
+)
+
+// How the webhook worker sends deliveries: how often it looks for due ones,
+// how long a claimed delivery is held back from other workers, how long a
+// receiver gets to answer, and how often a delivery is retried, waiting
+// webhookBackoff, then twice as long each time.
+const (
+	webhookPollInterval = 5 * time.Second
+	webhookLease        = time.Minute
+	webhookTimeout      = 10 * time.Second
+	webhookMaxAttempts  = 8
+	webhookBackoff      = 30 * time.Second
+)
+
+// webhookPayload is the JSON body of a delivery.
+type webhookPayload struct {
+	Event   string         `json:"event"`
+	Created time.Time      `json:"created"`
+	Snippet webhookSnippet `json:"snippet"`
+}
+
+type webhookSnippet struct {
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Visibility string    `json:"visibility"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	URL        string    `json:"url"`
+}
+
+// The webhookEvent() method queues an event about a snippet for delivery to
+// the webhooks of userID. Failing to queue it doesn't fail the request.
+func (app *application) webhookEvent(r *http.Request, userID int, event string, s *models.Snippet) {
+	if userID == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		Event:   event,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Snippet: webhookSnippet{
+			ID:         s.ID,
+			Title:      s.Title,
+			Content:    s.Content,
+			Visibility: s.Visibility,
+			Created:    s.Created.UTC(),
+			Expires:    s.Expires.UTC(),
+			URL:        app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", s.ID)),
+		},
+	})
+	if err != nil {
+		app.requestLogger(r).Error("webhook", "event", event, "error", err)
+		return
+	}
+
+	n, err := app.webhooks.Enqueue(r.Context(), userID, event, payload)
+	if err != nil {
+		app.requestLogger(r).Error("webhook", "event", event, "error", err)
+		return
+	}
+	if n > 0 && app.webhookWorker != nil {
+		app.webhookWorker.notify()
+	}
+}
+
+// signWebhook returns the X-Snippetbox-Signature header of a delivery: the
+// hex encoded HMAC-SHA256 of the body, keyed with the webhook's secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookWorker sends the due deliveries of every webhook in the background.
+// Several servers may run one against the same database: deliveries are
+// claimed before they are sent.
+type webhookWorker struct {
+	webhooks models.WebhookModelInterface
+	client   *http.Client
+	logger   *slog.Logger
+	wake     chan struct{}
+}
+
+// The newWebhookWorker() function returns a worker sending deliveries through
+// an HTTP client which, unless allowPrivate is set, refuses to connect to
+// loopback, private and link-local addresses, so that webhooks can't be used
+// to reach the server's own network.
+func newWebhookWorker(webhooks models.WebhookModelInterface, logger *slog.Logger, allowPrivate bool) *webhookWorker {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if addr := addrPort.Addr().Unmap(); !publicAddr(addr) {
+				return fmt.Errorf("webhook: refusing to connect to %s", addr)
+			}
+			return nil
+		}
+	}
+
+	return &webhookWorker{
+		webhooks: webhooks,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// No proxy from the environment, so that the dialer sees the
+			// receivers' addresses.
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// A redirect is an answer like any other: it isn't a 2xx.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func publicAddr(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// The notify() method wakes the worker up to send new deliveries without
+// waiting for the next poll.
+func (ww *webhookWorker) notify() {
+	select {
+	case ww.wake <- struct{}{}:
+	default:
+	}
+}
+
+// The run() method sends due deliveries until ctx is cancelled.
+func (ww *webhookWorker) run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ww.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ww.wake:
+		}
+	}
+}
+
+// The deliverDue() method sends the deliveries which are due, one after the
+// other.
+func (ww *webhookWorker) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := ww.webhooks.Due(ctx, 20)
+		if err != nil {
+			ww.logger.Error("webhook worker", "error", err)
+			return
+		}
+
+		claimed := 0
+		for _, d := range due {
+			ok, err := ww.webhooks.Claim(ctx, d, time.Now().Add(webhookLease))
+			if err != nil {
+				ww.logger.Error("webhook worker", "delivery", d.ID, "error", err)
+				return
+			}
+			if !ok {
+				continue
+			}
+			claimed++
+
+			ww.deliver(ctx, d)
+			if err := ww.webhooks.Finish(ctx, d); err != nil {
+				ww.logger.Error("webhook worker", "delivery", d.ID, "error", err)
+				return
+			}
+		}
+
+		// Stop once there is nothing left, or everything due is being sent
+		// by other workers.
+		if claimed == 0 {
+			return
+		}
+	}
+}
+
+// The deliver() method sends a delivery once, and records the outcome in d.
+// Deliveries which fail are retried with exponential backoff until they have
+// been tried webhookMaxAttempts times.
+func (ww *webhookWorker) deliver(ctx context.Context, d *models.WebhookDelivery) {
+	d.Attempts++
+	d.ResponseStatus = 0
+	d.Error = ""
+
+	err := ww.post(ctx, d)
+	switch {
+	case err == nil:
+		d.Status = models.DeliverySucceeded
+	case d.Attempts >= webhookMaxAttempts:
+		d.Status = models.DeliveryFailed
+		d.Error = err.Error()
+	default:
+		d.Error = err.Error()
+		d.NextAttempt = time.Now().Add(webhookBackoff << (d.Attempts - 1))
+	}
+
+	ww.logger.Info("webhook delivery", "delivery", d.ID, "webhook", d.WebhookID, "event", d.Event,
+		"attempts", d.Attempts, "status", d.Status, "response_status", d.ResponseStatus, "error", d.Error)
+}
+
+func (ww *webhookWorker) post(ctx context.Context, d *models.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhook")
+	req.Header.Set("X-Snippetbox-Event", d.Event)
+	req.Header.Set("X-Snippetbox-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Snippetbox-Signature", signWebhook(d.Secret, d.Payload))
+
+	resp, err := ww.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	d.ResponseStatus = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
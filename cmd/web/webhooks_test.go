@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"github.com/minhnghia2k3/snippet_box/internal/models/mocks"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	app := newTestApplication(t)
+	webhooks := app.webhooks.(*mocks.WebhookModel)
+	worker := newWebhookWorker(app.webhooks, app.logger, true)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The receiver checks signatures the way a real one would.
+	received := make(chan webhookPayload, 1)
+	failing := true
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Snippetbox-Signature") != signWebhook("secret", body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		if failing {
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		var payload webhookPayload
+		json.Unmarshal(body, &payload)
+		assert.Equal(t, r.Header.Get("X-Snippetbox-Event"), payload.Event)
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	csrfToken := ts.login(t, "real@gmail.com")
+
+	form := url.Values{}
+	form.Add("url", "ftp://example.com/")
+	form.Add("csrf_token", csrfToken)
+	code, _, body := ts.postForm(t, "/account/webhooks", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "This field must be an http or https URL")
+
+	form.Set("url", receiver.URL+"/hook")
+	code, header, _ := ts.postForm(t, "/account/webhooks", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/webhooks/1")
+
+	form = url.Values{}
+	form.Add("title", "Webhooks")
+	form.Add("content", "are called")
+	form.Add("expires", "7")
+	form.Add("visibility", models.VisibilityPublic)
+	form.Add("csrf_token", csrfToken)
+	code, _, _ = ts.postForm(t, "/snippet/create", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, len(webhooks.Sent), 1)
+
+	// A failed delivery is retried later.
+	worker.deliverDue(context.Background())
+	delivery := webhooks.Sent[0]
+	assert.Equal(t, delivery.Status, models.DeliveryPending)
+	assert.Equal(t, delivery.Attempts, 1)
+	assert.Equal(t, delivery.ResponseStatus, http.StatusServiceUnavailable)
+	assert.Equal(t, delivery.NextAttempt.After(time.Now().Add(webhookBackoff/2)), true)
+
+	failing = false
+	delivery.NextAttempt = time.Now()
+	worker.deliverDue(context.Background())
+	assert.Equal(t, delivery.Status, models.DeliverySucceeded)
+	assert.Equal(t, delivery.Attempts, 2)
+
+	payload := <-received
+	assert.Equal(t, payload.Event, webhookSnippetCreated)
+	assert.Equal(t, payload.Snippet.ID, 2)
+	assert.Equal(t, payload.Snippet.Title, "Webhooks")
+	assert.Equal(t, payload.Snippet.URL, "https://snippetbox.example.com/snippet/view/2")
+
+	code, _, body = ts.get(t, "/account/webhooks/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, receiver.URL+"/hook")
+	assert.StringContains(t, body, "succeeded")
+
+	form = url.Values{}
+	form.Add("delivery", "1")
+	form.Add("csrf_token", csrfToken)
+	code, _, _ = ts.postForm(t, "/account/webhooks/1/redeliver", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	worker.deliverDue(context.Background())
+	assert.Equal(t, len(webhooks.Sent), 2)
+	assert.Equal(t, webhooks.Sent[1].Status, models.DeliverySucceeded)
+	assert.Equal(t, (<-received).Snippet.ID, 2)
+
+	// Other users can't tell the webhook exists.
+	ts.resetClient(t)
+	csrfToken = ts.login(t, "admin@gmail.com")
+	code, _, _ = ts.get(t, "/account/webhooks/1")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	form = url.Values{}
+	form.Add("csrf_token", csrfToken)
+	code, _, _ = ts.postForm(t, "/account/webhooks/1/delete", form)
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	app := newTestApplication(t)
+
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	worker := newWebhookWorker(app.webhooks, app.logger, false)
+	d := &models.WebhookDelivery{ID: 1, WebhookID: 1, URL: receiver.URL, Payload: []byte("{}")}
+	worker.deliver(context.Background(), d)
+
+	assert.Equal(t, called, false)
+	assert.Equal(t, d.Status, "")
+	assert.StringContains(t, d.Error, "refusing to connect to 127.0.0.1")
+}
@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Email templates are embedded into the binary, like the UI files.
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer renders the embedded email templates and delivers them over SMTP.
+// When no SMTP host is configured messages are written to the logger instead,
+// which is handy in development and tests.
+type Mailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	sender   string
+	logger   *slog.Logger
+}
+
+// New returns a Mailer for the given SMTP server. An empty host disables
+// delivery and logs every message to logger instead.
+func New(host string, port int, username, password, sender string, logger *slog.Logger) *Mailer {
+	return &Mailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		sender:   sender,
+		logger:   logger,
+	}
+}
+
+// Send executes the "subject" and "plainBody" templates defined in
+// templateFile with data and sends the result to recipient.
+func (m *Mailer) Send(recipient, templateFile string, data any) error {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return err
+	}
+
+	if m.host == "" {
+		m.logger.Info("email", "recipient", recipient, "subject", strings.TrimSpace(subject.String()), "body", plainBody.String())
+		return nil
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", m.sender)
+	fmt.Fprintf(msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(msg, "Subject: %s\r\n", strings.TrimSpace(subject.String()))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.Write(plainBody.Bytes())
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	return smtp.SendMail(addr, auth, m.sender, []string{recipient}, msg.Bytes())
+}
@@ -0,0 +1,271 @@
+// Package migrations keeps the database schema in versioned SQL files which
+// are embedded in the binary, one directory per database driver.
+//
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql. The
+// versions applied to a database are recorded in its schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// DDL for the table recording applied versions, which can't itself be a
+// migration.
+var versionTable = map[string]string{
+	models.DriverMySQL:    `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied DATETIME NOT NULL)`,
+	models.DriverPostgres: `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied TIMESTAMP NOT NULL)`,
+	models.DriverSQLite:   `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied DATETIME NOT NULL)`,
+}
+
+// Migration is one step of the schema, with the SQL to apply and revert it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status pairs a migration with the time it was applied, which is zero for
+// pending migrations.
+type Status struct {
+	*Migration
+	Applied time.Time
+}
+
+// Migrator applies the migrations for the driver of a database.
+type Migrator struct {
+	DB         *models.DB
+	Migrations []*Migration
+}
+
+// New returns a Migrator holding the embedded migrations for the driver of db.
+func New(db *models.DB) (*Migrator, error) {
+	if _, ok := versionTable[db.Driver]; !ok {
+		return nil, fmt.Errorf("migrations: unsupported database driver %q", db.Driver)
+	}
+
+	sub, err := fs.Sub(files, db.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := load(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	// Schema changes can take far longer than the queries the application
+	// makes, so they don't get its query timeout.
+	db = &models.DB{DB: db.DB, Driver: db.Driver}
+
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// load reads the migrations in the top level of fsys, sorted by version.
+func load(fsys fs.FS) ([]*Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, name := range names {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migrations: %s: name must end in .up.sql or .down.sql", name)
+		}
+
+		v, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrations: %s: name must start with a positive version number", name)
+		}
+
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migrations: version %d is used by both %q and %q", version, m.Name, label)
+		}
+
+		if direction == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d needs both an up and a down file", m.Version)
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Status returns every known migration along with when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]*Status, len(m.Migrations))
+	for i, mig := range m.Migrations {
+		status[i] = &Status{Migration: mig, Applied: applied[mig.Version]}
+	}
+
+	return status, nil
+}
+
+// Up applies every pending migration in order and returns those it applied.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		err := m.run(ctx, mig, mig.Up, `INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`,
+			mig.Version, mig.Name, time.Now().UTC().Truncate(time.Second))
+		if err != nil {
+			return done, err
+		}
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+// Down reverts the n most recently applied migrations and returns those it
+// reverted, latest first.
+func (m *Migrator) Down(ctx context.Context, n int) ([]*Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < n; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+
+		err := m.run(ctx, mig, mig.Down, `DELETE FROM schema_migrations WHERE version = ?`, mig.Version)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+// run executes the statements of script and the bookkeeping query in a single
+// transaction. MySQL commits DDL statements implicitly, so there a failure
+// part-way through a script can leave it half applied.
+func (m *Migrator) run(ctx context.Context, mig *Migration, script, query string, args ...any) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migrations: %s: %w", mig, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// applied returns the time each applied version was applied at, creating the
+// schema_migrations table if this is the first run.
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	_, err := m.DB.ExecContext(ctx, versionTable[m.DB.Driver])
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// statements splits a script into its statements. Not every driver accepts
+// several statements in one Exec(), so they are run one at a time. Scripts are
+// split on semicolons, which therefore can't appear inside a statement or a
+// comment.
+func statements(script string) []string {
+	var stmts []string
+	for _, s := range strings.Split(script, ";") {
+		if s = strings.TrimSpace(s); s != "" && !onlyComments(s) {
+			stmts = append(stmts, s)
+		}
+	}
+	return stmts
+}
+
+func onlyComments(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the base name shared by the files of a migration.
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
@@ -0,0 +1,113 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+func TestStatements(t *testing.T) {
+	script := `-- A comment
+CREATE TABLE a (id INTEGER);
+
+-- Another comment
+CREATE TABLE b (id INTEGER);
+-- Trailing comment
+`
+	want := []string{
+		"-- A comment\nCREATE TABLE a (id INTEGER)",
+		"-- Another comment\nCREATE TABLE b (id INTEGER)",
+	}
+
+	got := statements(script)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	var versions [][]int
+	for _, driver := range []string{models.DriverMySQL, models.DriverPostgres, models.DriverSQLite} {
+		m, err := New(&models.DB{Driver: driver})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var v []int
+		for _, mig := range m.Migrations {
+			v = append(v, mig.Version)
+		}
+		versions = append(versions, v)
+	}
+
+	// Every driver must have the same versions, or the schemas drift apart.
+	for i := 1; i < len(versions); i++ {
+		if !reflect.DeepEqual(versions[i], versions[0]) {
+			t.Errorf("versions differ between drivers: %v", versions)
+		}
+	}
+}
+
+// The SQLite migrations can be run for real, against a throwaway database.
+func TestMigrator(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	db := &models.DB{DB: sqlDB, Driver: models.DriverSQLite}
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(m.Migrations) {
+		t.Errorf("applied %d migrations; want %d", len(applied), len(m.Migrations))
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied %d migrations twice", len(applied))
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.Applied.IsZero() {
+			t.Errorf("%s is pending after migrating up", s.Migration)
+		}
+	}
+
+	reverted, err := m.Down(ctx, len(m.Migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(m.Migrations) {
+		t.Errorf("reverted %d migrations; want %d", len(reverted), len(m.Migrations))
+	}
+
+	var tables int
+	err = sqlDB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`).Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("%d tables left after migrating down", tables)
+	}
+}
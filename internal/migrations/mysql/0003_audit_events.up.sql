@@ -0,0 +1,17 @@
+-- Append-only log of security-relevant events. user_id is the user the event
+-- concerns and actor_id the user who caused it, when that's someone else.
+-- Both become NULL when the user deletes their account.
+CREATE TABLE audit_events (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NULL,
+    actor_id INTEGER NULL,
+    action VARCHAR(64) NOT NULL,
+    detail VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    INDEX idx_audit_events_user (user_id, created),
+    INDEX idx_audit_events_created (created),
+    CONSTRAINT fk_audit_events_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_audit_events_actor FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
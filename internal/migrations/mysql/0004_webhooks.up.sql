@@ -0,0 +1,29 @@
+-- URLs users have asked to be notified at when something happens to their
+-- snippets. Payloads are signed with the secret.
+CREATE TABLE webhooks (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    created DATETIME NOT NULL,
+    INDEX idx_webhooks_user (user_id),
+    CONSTRAINT fk_webhooks_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Every attempt to deliver an event to a webhook. Pending deliveries are sent
+-- once next_attempt has passed.
+CREATE TABLE webhook_deliveries (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    webhook_id INTEGER NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    error VARCHAR(255) NOT NULL DEFAULT '',
+    next_attempt DATETIME NOT NULL,
+    created DATETIME NOT NULL,
+    INDEX idx_webhook_deliveries_webhook (webhook_id),
+    INDEX idx_webhook_deliveries_due (status, next_attempt),
+    CONSTRAINT fk_webhook_deliveries_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
@@ -0,0 +1,27 @@
+-- URLs users have asked to be notified at when something happens to their
+-- snippets. Payloads are signed with the secret.
+CREATE TABLE webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_webhooks_user ON webhooks(user_id);
+
+-- Every attempt to deliver an event to a webhook. Pending deliveries are sent
+-- once next_attempt has passed.
+CREATE TABLE webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    error VARCHAR(255) NOT NULL DEFAULT '',
+    next_attempt TIMESTAMP NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id);
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt);
@@ -0,0 +1,8 @@
+-- Token buckets of the rate limits, when they are shared between servers.
+-- updated is in nanoseconds since the Unix epoch.
+CREATE TABLE rate_limits (
+    bucket VARCHAR(255) NOT NULL PRIMARY KEY,
+    tokens REAL NOT NULL,
+    updated INTEGER NOT NULL
+);
+CREATE INDEX idx_rate_limits_updated ON rate_limits(updated);
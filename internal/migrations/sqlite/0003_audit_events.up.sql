@@ -0,0 +1,15 @@
+-- Append-only log of security-relevant events. user_id is the user the event
+-- concerns and actor_id the user who caused it, when that's someone else.
+-- Both become NULL when the user deletes their account.
+CREATE TABLE audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    actor_id INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(64) NOT NULL,
+    detail VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL
+);
+CREATE INDEX idx_audit_events_user ON audit_events(user_id, created);
+CREATE INDEX idx_audit_events_created ON audit_events(created);
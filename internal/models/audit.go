@@ -0,0 +1,159 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Audit event actions.
+const (
+	AuditSignup         = "signup"
+	AuditLoginSuccess   = "login.success"
+	AuditLoginFailure   = "login.failure"
+	AuditLogout         = "logout"
+	AuditPasswordChange = "password.change"
+	AuditRoleChange     = "role.change"
+	AuditSnippetCreate  = "snippet.create"
+	AuditSnippetDelete  = "snippet.delete"
+	AuditTokenCreate    = "token.create"
+	AuditTokenRevoke    = "token.revoke"
+)
+
+// AuditActions lists every audit event action, for filtering.
+var AuditActions = []string{
+	AuditSignup,
+	AuditLoginSuccess,
+	AuditLoginFailure,
+	AuditLogout,
+	AuditPasswordChange,
+	AuditRoleChange,
+	AuditSnippetCreate,
+	AuditSnippetDelete,
+	AuditTokenCreate,
+	AuditTokenRevoke,
+}
+
+// AuditEvent is a security-relevant event, such as a login. UserID is the user
+// it concerns, if any, and ActorID the user who caused it, when that's someone
+// else, such as an admin deleting a snippet.
+type AuditEvent struct {
+	ID        int
+	UserID    int
+	UserEmail string
+	ActorID   int
+	Action    string
+	Detail    string
+	IP        string
+	UserAgent string
+	Created   time.Time
+}
+
+// AuditFilter selects audit events. Zero fields match everything.
+type AuditFilter struct {
+	UserID int
+	Action string
+	Since  time.Time
+	Until  time.Time
+	// Maximum number of events, the latest first.
+	Limit int
+}
+
+// Wrap connection pool
+type AuditModel struct {
+	DB *DB
+}
+
+// The audit log is append-only: events can be recorded and read, never
+// changed or deleted.
+type AuditModelInterface interface {
+	Insert(ctx context.Context, e *AuditEvent) error
+	Search(ctx context.Context, filter AuditFilter) ([]*AuditEvent, error)
+}
+
+// Longest values kept for the free text columns.
+const (
+	maxAuditDetail    = 255
+	maxAuditUserAgent = 255
+)
+
+// Insert records e, stamped with the current time.
+func (m *AuditModel) Insert(ctx context.Context, e *AuditEvent) error {
+	query := `INSERT INTO audit_events (user_id, actor_id, action, detail, ip, user_agent, created)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	e.Created = now()
+	_, err := m.DB.ExecContext(ctx, query, nullInt(e.UserID), nullInt(e.ActorID), e.Action,
+		truncate(e.Detail, maxAuditDetail), e.IP, truncate(e.UserAgent, maxAuditUserAgent), e.Created)
+	return err
+}
+
+// Search returns the events matching filter, the latest first.
+func (m *AuditModel) Search(ctx context.Context, filter AuditFilter) ([]*AuditEvent, error) {
+	var where []string
+	var args []any
+	if filter.UserID != 0 {
+		where = append(where, "a.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Action != "" {
+		where = append(where, "a.action = ?")
+		args = append(args, filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "a.created >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "a.created < ?")
+		args = append(args, filter.Until.UTC())
+	}
+
+	query := `SELECT a.id, COALESCE(a.user_id, 0), COALESCE(u.email, ''), COALESCE(a.actor_id, 0),
+	a.action, a.detail, a.ip, a.user_agent, a.created
+	FROM audit_events a LEFT JOIN users u ON u.id = a.user_id`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY a.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := m.DB.reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	for rows.Next() {
+		e := &AuditEvent{}
+		err := rows.Scan(&e.ID, &e.UserID, &e.UserEmail, &e.ActorID, &e.Action, &e.Detail, &e.IP, &e.UserAgent, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+// truncate cuts s down to at most n runes.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
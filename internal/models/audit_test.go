@@ -0,0 +1,36 @@
+package models
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestAuditModelSearch(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	if _, err := (&UserModel{DB: db}).Insert(ctx, "Alice", "alice@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+
+	audit := &AuditModel{DB: db}
+	for _, action := range []string{AuditSignup, AuditLoginSuccess} {
+		if err := audit.Insert(ctx, &AuditEvent{UserID: 1, Action: action, IP: "192.0.2.1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Events are found by user, action and time.
+	filter := AuditFilter{UserID: 1, Action: AuditLoginSuccess, Since: time.Now().Add(-time.Hour), Until: time.Now().Add(time.Hour)}
+	events, err := audit.Search(ctx, filter)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].UserEmail, "alice@example.com")
+
+	filter.Until = time.Now().Add(-time.Minute)
+	events, err = audit.Search(ctx, filter)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(events), 0)
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values for DB.Driver.
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// DB wraps a sql.DB connection pool together with the driver behind it.
+// Models write their queries once, with "?" placeholders, and DB rewrites
+// them for the SQL dialect of the driver.
+//
+// Every query runs under the context passed by the caller, further limited to
+// QueryTimeout if that is set. Running out of QueryTimeout is reported as a
+// *QueryTimeoutError.
+type DB struct {
+	*sql.DB
+	Driver       string
+	QueryTimeout time.Duration
+	// Optional read replicas, used by read-only model methods.
+	Replicas *ReplicaSet
+}
+
+// ExecContext shadows sql.DB.ExecContext, rewriting the query for the driver
+// and applying the query timeout.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	q := db.deadline(ctx)
+	defer q.cancel()
+
+	res, err := db.DB.ExecContext(q.ctx, rebind(db.Driver, query), args...)
+	return res, q.err(err)
+}
+
+// QueryContext shadows sql.DB.QueryContext, rewriting the query for the driver
+// and applying the query timeout until the rows are closed.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	q := db.deadline(ctx)
+
+	rows, err := db.DB.QueryContext(q.ctx, rebind(db.Driver, query), args...)
+	if err != nil {
+		q.cancel()
+		return nil, q.err(err)
+	}
+	return &Rows{Rows: rows, deadline: q}, nil
+}
+
+// QueryRowContext shadows sql.DB.QueryRowContext, rewriting the query for the
+// driver and applying the query timeout until the row is scanned.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	q := db.deadline(ctx)
+	return &Row{row: db.DB.QueryRowContext(q.ctx, rebind(db.Driver, query), args...), deadline: q}
+}
+
+// BeginTx starts a transaction whose queries are rewritten and time limited
+// like those of DB.
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, driver: db.Driver, timeout: db.QueryTimeout}, nil
+}
+
+// insert runs an INSERT statement and returns the id of the new row.
+func (db *DB) insert(ctx context.Context, query string, args ...any) (int, error) {
+	return insert(ctx, db, db.Driver, query, args...)
+}
+
+func (db *DB) deadline(ctx context.Context) *deadline {
+	return newDeadline(ctx, db.QueryTimeout)
+}
+
+// Tx wraps a sql.Tx started by DB.BeginTx().
+type Tx struct {
+	*sql.Tx
+	driver  string
+	timeout time.Duration
+}
+
+// ExecContext shadows sql.Tx.ExecContext, like DB.ExecContext.
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	q := newDeadline(ctx, tx.timeout)
+	defer q.cancel()
+
+	res, err := tx.Tx.ExecContext(q.ctx, rebind(tx.driver, query), args...)
+	return res, q.err(err)
+}
+
+// QueryContext shadows sql.Tx.QueryContext, like DB.QueryContext.
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	q := newDeadline(ctx, tx.timeout)
+
+	rows, err := tx.Tx.QueryContext(q.ctx, rebind(tx.driver, query), args...)
+	if err != nil {
+		q.cancel()
+		return nil, q.err(err)
+	}
+	return &Rows{Rows: rows, deadline: q}, nil
+}
+
+// QueryRowContext shadows sql.Tx.QueryRowContext, like DB.QueryRowContext.
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	q := newDeadline(ctx, tx.timeout)
+	return &Row{row: tx.Tx.QueryRowContext(q.ctx, rebind(tx.driver, query), args...), deadline: q}
+}
+
+// insert runs an INSERT statement and returns the id of the new row.
+func (tx *Tx) insert(ctx context.Context, query string, args ...any) (int, error) {
+	return insert(ctx, tx, tx.driver, query, args...)
+}
+
+// Rows wraps sql.Rows, releasing the query timeout when closed.
+type Rows struct {
+	*sql.Rows
+	deadline *deadline
+}
+
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.deadline.cancel()
+	return err
+}
+
+func (r *Rows) Err() error {
+	return r.deadline.err(r.Rows.Err())
+}
+
+// Row wraps sql.Row, releasing the query timeout once scanned. Scan() must
+// always be called.
+type Row struct {
+	row      *sql.Row
+	deadline *deadline
+}
+
+func (r *Row) Scan(dest ...any) error {
+	defer r.deadline.cancel()
+	return r.deadline.err(r.row.Scan(dest...))
+}
+
+// deadline limits a query to a timeout on top of the caller's context, so
+// that running out of the timeout can be told apart from the caller giving up.
+type deadline struct {
+	parent  context.Context
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+func newDeadline(parent context.Context, timeout time.Duration) *deadline {
+	q := &deadline{parent: parent, ctx: parent, cancel: func() {}, timeout: timeout}
+	if timeout > 0 {
+		q.ctx, q.cancel = context.WithTimeout(parent, timeout)
+	}
+	return q
+}
+
+// err turns err into a *QueryTimeoutError if the query failed because the
+// timeout expired, rather than because of the parent context.
+func (q *deadline) err(err error) error {
+	if err == nil || q.timeout <= 0 {
+		return err
+	}
+	if errors.Is(q.ctx.Err(), context.DeadlineExceeded) && q.parent.Err() == nil {
+		return &QueryTimeoutError{Timeout: q.timeout, Err: err}
+	}
+	return err
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *Row
+}
+
+// PostgreSQL has no LastInsertId(), so the id is asked for with RETURNING
+// instead. The table is expected to have an "id" column.
+func insert(ctx context.Context, q querier, driver, query string, args ...any) (int, error) {
+	if driver == DriverPostgres {
+		var id int
+		err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// rebind replaces the "?" placeholders in query with the numbered "$1", "$2"...
+// placeholders PostgreSQL expects. Question marks inside quoted strings are
+// left alone. Other drivers get the query unchanged.
+func rebind(driver, query string) string {
+	if driver != DriverPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	quoted := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// containsPattern returns the LIKE pattern matching the strings which contain
+// s, lowercased, with the "%" and "_" wildcards in s escaped by a backslash.
+// Use it with likeEscape().
+func containsPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(s))
+	return "%" + s + "%"
+}
+
+// likeEscape returns the ESCAPE clause making a backslash the escape character
+// of a LIKE pattern. MySQL reads backslashes in string literals as escapes
+// themselves, so it needs two.
+func likeEscape(driver string) string {
+	if driver == DriverMySQL {
+		return `ESCAPE '\\'`
+	}
+	return `ESCAPE '\'`
+}
+
+// now returns the current time in UTC, in the whole seconds DATETIME columns
+// store. Timestamps are computed here rather than with SQL functions, which
+// differ between databases. SQLite keeps them as text, which only sorts and
+// compares correctly because they are all written in the same zone.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
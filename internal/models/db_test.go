@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		query  string
+		want   string
+	}{
+		{
+			name:   "MySQL",
+			driver: DriverMySQL,
+			query:  "SELECT id FROM users WHERE email = ? AND id = ?",
+			want:   "SELECT id FROM users WHERE email = ? AND id = ?",
+		},
+		{
+			name:   "PostgreSQL",
+			driver: DriverPostgres,
+			query:  "SELECT id FROM users WHERE email = ? AND id = ?",
+			want:   "SELECT id FROM users WHERE email = $1 AND id = $2",
+		},
+		{
+			name:   "Quoted question mark",
+			driver: DriverPostgres,
+			query:  "SELECT COALESCE(name, '?') FROM users WHERE id = ?",
+			want:   "SELECT COALESCE(name, '?') FROM users WHERE id = $1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, rebind(tt.driver, tt.query), tt.want)
+		})
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	db := &DB{DB: sqlDB, Driver: DriverSQLite, QueryTimeout: 50 * time.Millisecond}
+
+	// Counts forever, until the query is interrupted.
+	query := `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT COUNT(*) FROM c`
+
+	t.Run("Timeout", func(t *testing.T) {
+		var n int
+		err := db.QueryRowContext(context.Background(), query).Scan(&n)
+
+		var timeoutError *QueryTimeoutError
+		assert.Equal(t, errors.As(err, &timeoutError), true)
+	})
+
+	t.Run("Caller cancels", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		var n int
+		err := db.QueryRowContext(ctx, query).Scan(&n)
+
+		var timeoutError *QueryTimeoutError
+		assert.Equal(t, err != nil, true)
+		assert.Equal(t, errors.As(err, &timeoutError), false)
+	})
+
+	t.Run("Fast query", func(t *testing.T) {
+		var n int
+		err := db.QueryRowContext(context.Background(), `SELECT 1`).Scan(&n)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, n, 1)
+	})
+}
+
+// newTestDB returns a throwaway SQLite database with the schema of the SQLite
+// migrations. The migrations package imports this one, so the up scripts are
+// read from disk rather than run through it.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	scripts, err := filepath.Glob(filepath.Join("..", "migrations", DriverSQLite, "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range scripts {
+		b, err := os.ReadFile(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sqlDB.Exec(string(b)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(script), err)
+		}
+	}
+
+	return &DB{DB: sqlDB, Driver: DriverSQLite}
+}
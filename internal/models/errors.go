@@ -1,6 +1,10 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrNoRecord = errors.New("models: no matching record found")
@@ -8,4 +12,22 @@ var (
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	ErrDuplicateSnippet = errors.New("models: duplicate snippet")
+
+	ErrAccountDisabled = errors.New("models: account disabled")
 )
+
+// QueryTimeoutError is returned when a query is cut off by DB.QueryTimeout.
+type QueryTimeoutError struct {
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *QueryTimeoutError) Error() string {
+	return fmt.Sprintf("models: query timed out after %s: %v", e.Timeout, e.Err)
+}
+
+func (e *QueryTimeoutError) Unwrap() error {
+	return e.Err
+}
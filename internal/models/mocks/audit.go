@@ -0,0 +1,38 @@
+package mocks
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"sync"
+	"time"
+)
+
+// AuditModel keeps the events recorded, for tests to look at.
+type AuditModel struct {
+	mu     sync.Mutex
+	Events []*models.AuditEvent
+}
+
+func (m *AuditModel) Insert(ctx context.Context, e *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = len(m.Events) + 1
+	e.Created = time.Now()
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+func (m *AuditModel) Search(ctx context.Context, filter models.AuditFilter) ([]*models.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []*models.AuditEvent{}
+	for i := len(m.Events) - 1; i >= 0; i-- {
+		e := m.Events[i]
+		if (filter.UserID == 0 || e.UserID == filter.UserID) && (filter.Action == "" || e.Action == filter.Action) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,55 @@
+package mocks
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"time"
+)
+
+// Organization 1 is owned by user 1. User 2 isn't a member of anything.
+type OrganizationModel struct{}
+
+func (m *OrganizationModel) Insert(ctx context.Context, name string, ownerID int) (int, error) {
+	return 2, nil
+}
+
+func (m *OrganizationModel) Get(ctx context.Context, id int) (*models.Organization, error) {
+	switch id {
+	case 1:
+		return &models.Organization{ID: 1, Name: "Acme", Created: time.Now()}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *OrganizationModel) ForUser(ctx context.Context, userID int) ([]*models.Organization, error) {
+	switch userID {
+	case 1:
+		return []*models.Organization{
+			{ID: 1, Name: "Acme", Created: time.Now(), Role: models.OrgRoleOwner},
+		}, nil
+	default:
+		return []*models.Organization{}, nil
+	}
+}
+
+func (m *OrganizationModel) Members(ctx context.Context, id int) ([]*models.OrganizationMember, error) {
+	return []*models.OrganizationMember{
+		{UserID: 1, Name: "test", Email: "test@gmail.com", Role: models.OrgRoleOwner, Joined: time.Now()},
+	}, nil
+}
+
+func (m *OrganizationModel) MemberRole(ctx context.Context, id, userID int) (string, error) {
+	if id == 1 && userID == 1 {
+		return models.OrgRoleOwner, nil
+	}
+	return "", models.ErrNoRecord
+}
+
+func (m *OrganizationModel) AddMember(ctx context.Context, id, userID int, role string) error {
+	return nil
+}
+
+func (m *OrganizationModel) RemoveMember(ctx context.Context, id, userID int) error {
+	return nil
+}
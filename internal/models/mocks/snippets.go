@@ -1,33 +1,93 @@
 package mocks
 
 import (
+	"context"
 	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"strings"
 	"time"
 )
 
 var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	UserID:     1,
+	Title:      "An old silent pond",
+	Content:    "An old silent pond",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+}
+
+// Only visible to members of organization 1.
+var mockOrganizationSnippet = &models.Snippet{
+	ID:             3,
+	UserID:         1,
+	OrganizationID: 1,
+	Title:          "Over the wintry forest",
+	Content:        "Over the wintry forest",
+	Visibility:     models.VisibilityOrganization,
+	Created:        time.Now(),
+	Expires:        time.Now(),
 }
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
+func (m *SnippetModel) Insert(ctx context.Context, userID, organizationID int, title, content, visibility string, expires int) (int, error) {
 	return 2, nil
 }
 
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+func (m *SnippetModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockOrganizationSnippet, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
 
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
+func (m *SnippetModel) Latest(ctx context.Context) ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) ForOrganization(ctx context.Context, organizationID int) ([]*models.Snippet, error) {
+	switch organizationID {
+	case 1:
+		return []*models.Snippet{mockOrganizationSnippet}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
+
+func (m *SnippetModel) ForUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []*models.Snippet{mockSnippet}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
+
+func (m *SnippetModel) Search(ctx context.Context, userID int, query string) ([]*models.Snippet, error) {
+	snippets := []*models.Snippet{}
+	if userID != 1 {
+		return snippets, nil
+	}
+
+	query = strings.ToLower(query)
+	for _, s := range []*models.Snippet{mockSnippet, mockOrganizationSnippet} {
+		if strings.Contains(strings.ToLower(s.Title), query) || strings.Contains(strings.ToLower(s.Content), query) {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets, nil
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
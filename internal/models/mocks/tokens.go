@@ -0,0 +1,35 @@
+package mocks
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"sync"
+	"time"
+)
+
+// TokenModel keeps the ids of the users whose tokens were deleted, by scope,
+// for tests to look at.
+type TokenModel struct {
+	mu      sync.Mutex
+	Deleted map[string][]int
+}
+
+func (m *TokenModel) New(ctx context.Context, userID int, ttl time.Duration, scope string) (*models.Token, error) {
+	return &models.Token{
+		Plaintext: "VALIDTOKEN",
+		UserID:    userID,
+		Expiry:    time.Now().Add(ttl),
+		Scope:     scope,
+	}, nil
+}
+
+func (m *TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Deleted == nil {
+		m.Deleted = make(map[string][]int)
+	}
+	m.Deleted[scope] = append(m.Deleted[scope], userID)
+	return nil
+}
@@ -1,49 +1,84 @@
 package mocks
 
 import (
+	"context"
 	"github.com/minhnghia2k3/snippet_box/internal/models"
 	"time"
 )
 
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
 	switch email {
 	case "dupe@gmail.com":
-		return models.ErrDuplicateEmail
+		return 0, models.ErrDuplicateEmail
 	default:
-		return nil
+		return 3, nil
 	}
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "real@gmail.com" && password == "pa$$word" {
-		return 1, nil
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	if password == "pa$$word" {
+		switch email {
+		case "real@gmail.com":
+			return 1, nil
+		case "admin@gmail.com":
+			return 2, nil
+		case "disabled@gmail.com":
+			return 0, models.ErrAccountDisabled
+		}
 	}
-	return 0, models.ErrNoRecord
+	return 0, models.ErrInvalidCredentials
 }
 
-func (m *UserModel) Exists(id int) (bool, error) {
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2:
 		return true, nil
 	default:
 		return false, nil
 	}
 }
 
-func (m *UserModel) Get(id int) (*models.User, error) {
-	user := models.User{
-		ID:           id,
-		Name:         "test",
-		Email:        "test@gmail.com",
-		HashPassword: []byte("pa$$word"),
-		Created:      time.Now(),
+func (m *UserModel) Get(ctx context.Context, id int) (*models.User, error) {
+	switch id {
+	case 1:
+		return &models.User{
+			ID:           id,
+			Name:         "test",
+			Email:        "test@gmail.com",
+			HashPassword: []byte("pa$$word"),
+			Created:      time.Now(),
+			Role:         models.RoleUser,
+		}, nil
+	case 2:
+		return &models.User{
+			ID:      id,
+			Name:    "admin",
+			Email:   "admin@gmail.com",
+			Created: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			Role:    models.RoleAdmin,
+		}, nil
+	default:
+		return nil, models.ErrNoRecord
 	}
-	return &user, nil
 }
 
-func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	switch email {
+	case "real@gmail.com":
+		return &models.User{
+			ID:      1,
+			Name:    "test",
+			Email:   email,
+			Created: time.Now(),
+		}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) error {
 	if id == 1 {
 		if currentPassword != "pa$$word" {
 			return models.ErrInvalidCredentials
@@ -52,3 +87,55 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 	}
 	return models.ErrNoRecord
 }
+
+func (m *UserModel) UpdateName(ctx context.Context, id int, name string) error {
+	return nil
+}
+
+func (m *UserModel) SetPendingEmail(ctx context.Context, id int, email string) error {
+	return nil
+}
+
+func (m *UserModel) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*models.User, error) {
+	if scope == models.ScopeAPI {
+		switch tokenPlaintext {
+		case "VALIDTOKEN":
+			return m.Get(ctx, 1)
+		case "RESETTOKEN":
+			user, err := m.Get(ctx, 1)
+			user.PasswordResetRequired = true
+			return user, err
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *UserModel) ConfirmEmail(ctx context.Context, tokenPlaintext string) error {
+	switch tokenPlaintext {
+	case "VALIDTOKEN":
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) Delete(ctx context.Context, id int, password string, deleteSnippets bool) error {
+	if id == 1 && password == "pa$$word" {
+		return nil
+	}
+	return models.ErrInvalidCredentials
+}
+
+func (m *UserModel) Search(ctx context.Context, query string) ([]*models.User, error) {
+	user, _ := m.Get(ctx, 1)
+	admin, _ := m.Get(ctx, 2)
+	return []*models.User{user, admin}, nil
+}
+
+func (m *UserModel) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	return nil
+}
+
+func (m *UserModel) RequirePasswordReset(ctx context.Context, id int) error {
+	return nil
+}
@@ -0,0 +1,161 @@
+package mocks
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/models"
+	"sync"
+	"time"
+)
+
+// WebhookModel keeps webhooks and their deliveries in memory, so that tests
+// can send deliveries for real. Sent holds every delivery ever queued.
+type WebhookModel struct {
+	mu       sync.Mutex
+	Webhooks []*models.Webhook
+	Sent     []*models.WebhookDelivery
+}
+
+func (m *WebhookModel) Insert(ctx context.Context, userID int, url string) (*models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := &models.Webhook{ID: len(m.Webhooks) + 1, UserID: userID, URL: url, Secret: "secret", Created: time.Now()}
+	m.Webhooks = append(m.Webhooks, w)
+	return w, nil
+}
+
+func (m *WebhookModel) Get(ctx context.Context, id int) (*models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.get(id)
+}
+
+func (m *WebhookModel) ForUser(ctx context.Context, userID int) ([]*models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := []*models.Webhook{}
+	for _, w := range m.Webhooks {
+		if w != nil && w.UserID == userID {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *WebhookModel) Delete(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.get(id); err != nil {
+		return err
+	}
+	m.Webhooks[id-1] = nil
+	return nil
+}
+
+func (m *WebhookModel) Enqueue(ctx context.Context, userID int, event string, payload []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, w := range m.Webhooks {
+		if w != nil && w.UserID == userID {
+			m.enqueue(w.ID, event, payload)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *WebhookModel) Deliveries(ctx context.Context, webhookID int) ([]*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for i := len(m.Sent) - 1; i >= 0; i-- {
+		if d := m.Sent[i]; d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *WebhookModel) Redeliver(ctx context.Context, webhookID, deliveryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if deliveryID < 1 || deliveryID > len(m.Sent) || m.Sent[deliveryID-1].WebhookID != webhookID {
+		return models.ErrNoRecord
+	}
+	d := m.Sent[deliveryID-1]
+	m.enqueue(webhookID, d.Event, d.Payload)
+	return nil
+}
+
+func (m *WebhookModel) Due(ctx context.Context, limit int) ([]*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := []*models.WebhookDelivery{}
+	for _, d := range m.Sent {
+		if len(due) < limit && d.Status == models.DeliveryPending && !d.NextAttempt.After(time.Now()) {
+			w, err := m.get(d.WebhookID)
+			if err != nil {
+				continue
+			}
+			copy := *d
+			copy.URL, copy.Secret = w.URL, w.Secret
+			due = append(due, &copy)
+		}
+	}
+	return due, nil
+}
+
+func (m *WebhookModel) Claim(ctx context.Context, d *models.WebhookDelivery, until time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.Sent[d.ID-1]
+	if stored.Status != models.DeliveryPending || stored.Attempts != d.Attempts || stored.NextAttempt.After(time.Now()) {
+		return false, nil
+	}
+	stored.NextAttempt = until
+	return true, nil
+}
+
+func (m *WebhookModel) Finish(ctx context.Context, d *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.Sent[d.ID-1]
+	stored.Status = d.Status
+	stored.Attempts = d.Attempts
+	stored.ResponseStatus = d.ResponseStatus
+	stored.Error = d.Error
+	stored.NextAttempt = d.NextAttempt
+	return nil
+}
+
+// get returns a webhook which hasn't been deleted. The caller must hold m.mu.
+func (m *WebhookModel) get(id int) (*models.Webhook, error) {
+	if id < 1 || id > len(m.Webhooks) || m.Webhooks[id-1] == nil {
+		return nil, models.ErrNoRecord
+	}
+	return m.Webhooks[id-1], nil
+}
+
+// The caller must hold m.mu.
+func (m *WebhookModel) enqueue(webhookID int, event string, payload []byte) {
+	now := time.Now()
+	m.Sent = append(m.Sent, &models.WebhookDelivery{
+		ID:          len(m.Sent) + 1,
+		WebhookID:   webhookID,
+		Event:       event,
+		Payload:     payload,
+		Status:      models.DeliveryPending,
+		NextAttempt: now,
+		Created:     now,
+	})
+}
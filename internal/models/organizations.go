@@ -0,0 +1,180 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Organization member roles.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+type Organization struct {
+	ID      int
+	Name    string
+	Created time.Time
+	// Role of the user the organization was loaded for, if any.
+	Role string
+}
+
+type OrganizationMember struct {
+	UserID int
+	Name   string
+	Email  string
+	Role   string
+	Joined time.Time
+}
+
+// Wrap connection pool
+type OrganizationModel struct {
+	DB *DB
+}
+
+type OrganizationModelInterface interface {
+	Insert(ctx context.Context, name string, ownerID int) (int, error)
+	Get(ctx context.Context, id int) (*Organization, error)
+	ForUser(ctx context.Context, userID int) ([]*Organization, error)
+	Members(ctx context.Context, id int) ([]*OrganizationMember, error)
+	MemberRole(ctx context.Context, id, userID int) (string, error)
+	AddMember(ctx context.Context, id, userID int, role string) error
+	RemoveMember(ctx context.Context, id, userID int) error
+}
+
+// Insert creates an organization with ownerID as its first owner.
+func (m *OrganizationModel) Insert(ctx context.Context, name string, ownerID int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	created := now()
+
+	query := `INSERT INTO organizations (name, created) VALUES(?, ?)`
+	id, err := tx.insert(ctx, query, name, created)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `INSERT INTO organization_members (organization_id, user_id, role, created)
+	VALUES(?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query, id, ownerID, OrgRoleOwner, created)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// Get returns the organization with the given id.
+func (m *OrganizationModel) Get(ctx context.Context, id int) (*Organization, error) {
+	query := `SELECT id, name, created FROM organizations WHERE id = ?`
+
+	o := &Organization{}
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&o.ID, &o.Name, &o.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// ForUser returns the organizations the user is a member of, along with the
+// user's role in each.
+func (m *OrganizationModel) ForUser(ctx context.Context, userID int) ([]*Organization, error) {
+	query := `SELECT o.id, o.name, o.created, om.role FROM organizations o
+	INNER JOIN organization_members om ON om.organization_id = o.id
+	WHERE om.user_id = ? ORDER BY o.name`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	organizations := []*Organization{}
+	for rows.Next() {
+		o := &Organization{}
+		err := rows.Scan(&o.ID, &o.Name, &o.Created, &o.Role)
+		if err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return organizations, nil
+}
+
+// Members returns the members of the organization, owners first.
+func (m *OrganizationModel) Members(ctx context.Context, id int) ([]*OrganizationMember, error) {
+	query := `SELECT u.id, u.name, u.email, om.role, om.created FROM organization_members om
+	INNER JOIN users u ON u.id = om.user_id
+	WHERE om.organization_id = ? ORDER BY om.role DESC, u.name`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*OrganizationMember{}
+	for rows.Next() {
+		om := &OrganizationMember{}
+		err := rows.Scan(&om.UserID, &om.Name, &om.Email, &om.Role, &om.Joined)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, om)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// MemberRole returns the role of the user in the organization, or ErrNoRecord
+// if they aren't a member.
+func (m *OrganizationModel) MemberRole(ctx context.Context, id, userID int) (string, error) {
+	query := `SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ?`
+
+	var role string
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+
+	return role, nil
+}
+
+// AddMember adds the user to the organization with the given role.
+func (m *OrganizationModel) AddMember(ctx context.Context, id, userID int, role string) error {
+	query := `INSERT INTO organization_members (organization_id, user_id, role, created)
+	VALUES(?, ?, ?, ?)`
+
+	_, err := m.DB.ExecContext(ctx, query, id, userID, role, now())
+	return err
+}
+
+// RemoveMember removes the user from the organization.
+func (m *OrganizationModel) RemoveMember(ctx context.Context, id, userID int) error {
+	query := `DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?`
+
+	_, err := m.DB.ExecContext(ctx, query, id, userID)
+	return err
+}
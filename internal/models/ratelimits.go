@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RateLimitBucket is the state of a token bucket: the tokens left in it when it
+// was last updated.
+type RateLimitBucket struct {
+	Key     string
+	Tokens  float64
+	Updated time.Time
+}
+
+// RateLimitModel keeps token buckets in the "rate_limits" table, so that
+// several servers enforce the same limits. Buckets are updated with
+// compare-and-swap rather than locks, which every driver supports alike.
+type RateLimitModel struct {
+	DB *DB
+}
+
+// Get returns the bucket stored under key, or ErrNoRecord.
+func (m *RateLimitModel) Get(ctx context.Context, key string) (*RateLimitBucket, error) {
+	query := `SELECT tokens, updated FROM rate_limits WHERE bucket = ?`
+
+	b := &RateLimitBucket{Key: key}
+	var updated int64
+	err := m.DB.QueryRowContext(ctx, query, key).Scan(&b.Tokens, &updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	b.Updated = time.Unix(0, updated)
+
+	return b, nil
+}
+
+// Put stores b, provided the bucket hasn't changed since it was read as old,
+// which is nil for a bucket that didn't exist. It reports whether b was
+// stored; when it wasn't, another server got there first and the caller should
+// read the bucket again.
+func (m *RateLimitModel) Put(ctx context.Context, b, old *RateLimitBucket) (bool, error) {
+	var query string
+	var args []any
+	switch {
+	case old != nil:
+		query = `UPDATE rate_limits SET tokens = ?, updated = ? WHERE bucket = ? AND updated = ?`
+		args = []any{b.Tokens, b.Updated.UnixNano(), b.Key, old.Updated.UnixNano()}
+	case m.DB.Driver == DriverMySQL:
+		query = `INSERT IGNORE INTO rate_limits (bucket, tokens, updated) VALUES (?, ?, ?)`
+		args = []any{b.Key, b.Tokens, b.Updated.UnixNano()}
+	default:
+		query = `INSERT INTO rate_limits (bucket, tokens, updated) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`
+		args = []any{b.Key, b.Tokens, b.Updated.UnixNano()}
+	}
+
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// DeleteStale removes the buckets which haven't been updated since before.
+func (m *RateLimitModel) DeleteStale(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM rate_limits WHERE updated < ?`
+
+	_, err := m.DB.ExecContext(ctx, query, before.UnixNano())
+	return err
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestRateLimitModelPut(t *testing.T) {
+	limits := &RateLimitModel{DB: newTestDB(t)}
+	ctx := context.Background()
+
+	// Buckets are compare-and-swapped: only the first writer wins.
+	bucket := &RateLimitBucket{Key: "test", Tokens: 5, Updated: time.Unix(0, 1)}
+	for _, want := range []bool{true, false} {
+		ok, err := limits.Put(ctx, bucket, nil)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, ok, want)
+	}
+
+	next := &RateLimitBucket{Key: "test", Tokens: 4, Updated: time.Unix(0, 2)}
+	for _, want := range []bool{true, false} {
+		ok, err := limits.Put(ctx, next, bucket)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, ok, want)
+	}
+
+	got, err := limits.Get(ctx, "test")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, got.Tokens, 4.0)
+}
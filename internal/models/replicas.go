@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaSet holds read replicas of the primary database. Read-only model
+// methods are spread over the healthy replicas in turn, and go to the primary
+// when there are none.
+type ReplicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// NewReplicaSet returns a ReplicaSet of the given connection pools. Replicas
+// count as unhealthy until the first Check().
+func NewReplicaSet(dbs ...*sql.DB) *ReplicaSet {
+	rs := &ReplicaSet{}
+	for _, db := range dbs {
+		rs.replicas = append(rs.replicas, &replica{db: db})
+	}
+	return rs
+}
+
+// Check pings every replica, giving each timeout to answer, and records which
+// are healthy.
+func (rs *ReplicaSet) Check(ctx context.Context, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range rs.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			r.healthy.Store(r.db.PingContext(ctx) == nil)
+		}()
+	}
+	wg.Wait()
+}
+
+// Monitor runs Check() every interval until ctx is done.
+func (rs *ReplicaSet) Monitor(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rs.Check(ctx, timeout)
+		}
+	}
+}
+
+// Healthy returns the number of replicas which passed the last check.
+func (rs *ReplicaSet) Healthy() int {
+	n := 0
+	for _, r := range rs.replicas {
+		if r.healthy.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// DBs returns the connection pools of the replicas.
+func (rs *ReplicaSet) DBs() []*sql.DB {
+	dbs := make([]*sql.DB, len(rs.replicas))
+	for i, r := range rs.replicas {
+		dbs[i] = r.db
+	}
+	return dbs
+}
+
+// Close closes every replica.
+func (rs *ReplicaSet) Close() error {
+	var err error
+	for _, r := range rs.replicas {
+		if closeErr := r.db.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// pick returns the next healthy replica in round-robin order, or nil if there
+// is none.
+func (rs *ReplicaSet) pick() *sql.DB {
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := rs.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return nil
+}
+
+type primaryContextKey struct{}
+
+// WithPrimary returns a context under which reads go to the primary database
+// even when replicas are available. It is meant for reads which must see a
+// write that was just made, and which a replica may not have caught up with.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+// UsesPrimary reports whether ctx was returned by WithPrimary().
+func UsesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
+
+// reader returns the database that a read-only query made under ctx should
+// go to: a healthy replica if there is one, or else the primary.
+func (db *DB) reader(ctx context.Context) *DB {
+	if db.Replicas == nil || UsesPrimary(ctx) {
+		return db
+	}
+
+	replica := db.Replicas.pick()
+	if replica == nil {
+		return db
+	}
+
+	return &DB{DB: replica, Driver: db.Driver, QueryTimeout: db.QueryTimeout}
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	open := func() *sql.DB {
+		db, err := sql.Open("sqlite", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	primary := open()
+	replica1, replica2 := open(), open()
+
+	db := &DB{DB: primary, Driver: DriverSQLite}
+	ctx := context.Background()
+
+	// Without replicas, everything goes to the primary.
+	assert.Equal(t, db.reader(ctx).DB, primary)
+
+	db.Replicas = NewReplicaSet(replica1, replica2)
+
+	// Replicas aren't used before they've been checked.
+	assert.Equal(t, db.reader(ctx).DB, primary)
+
+	db.Replicas.Check(ctx, time.Second)
+	assert.Equal(t, db.Replicas.Healthy(), 2)
+
+	// Healthy replicas take turns.
+	first, second := db.reader(ctx).DB, db.reader(ctx).DB
+	assert.Equal(t, first != primary && second != primary, true)
+	assert.Equal(t, first != second, true)
+	assert.Equal(t, db.reader(ctx).DB, first)
+
+	// Reads which must see the latest writes stay on the primary.
+	assert.Equal(t, db.reader(WithPrimary(ctx)).DB, primary)
+
+	// An unreachable replica is skipped.
+	replica1.Close()
+	db.Replicas.Check(ctx, time.Second)
+	assert.Equal(t, db.Replicas.Healthy(), 1)
+	assert.Equal(t, db.reader(ctx).DB, replica2)
+	assert.Equal(t, db.reader(ctx).DB, replica2)
+
+	// With none left, reads fall back to the primary.
+	replica2.Close()
+	db.Replicas.Check(ctx, time.Second)
+	assert.Equal(t, db.reader(ctx).DB, primary)
+}
@@ -1,61 +1,78 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
 )
 
+// Snippet visibilities.
+const (
+	// Anyone can see the snippet.
+	VisibilityPublic = "public"
+	// Only members of the snippet's organization can see it.
+	VisibilityOrganization = "organization"
+)
+
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID             int
+	UserID         int // Zero once the author has deleted their account.
+	OrganizationID int // Zero for personal snippets.
+	Title          string
+	Content        string
+	Visibility     string
+	Created        time.Time
+	Expires        time.Time
 }
 
 // Define SnippetModel which wraps a sql.DB connection pool
 type SnippetModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
 type SnippetModelInterface interface {
-	Insert(title, content string, expires int) (int, error)
-	Get(id int) (*Snippet, error)
-	Latest() ([]*Snippet, error)
+	Insert(ctx context.Context, userID, organizationID int, title, content, visibility string, expires int) (int, error)
+	Get(ctx context.Context, id int) (*Snippet, error)
+	Latest(ctx context.Context) ([]*Snippet, error)
+	ForOrganization(ctx context.Context, organizationID int) ([]*Snippet, error)
+	ForUser(ctx context.Context, userID int) ([]*Snippet, error)
+	Search(ctx context.Context, userID int, query string) ([]*Snippet, error)
+	Delete(ctx context.Context, id int) error
 }
 
-// This function will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
-	query := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+// The columns read into a Snippet by the queries below, in the order expected
+// by Snippet.dest().
+const snippetColumns = `id, COALESCE(user_id, 0), COALESCE(organization_id, 0), title, content, visibility, created, expires`
 
-	res, err := m.DB.Exec(query, title, content, expires)
-	if err != nil {
-		return 0, nil
-	}
+// dest returns pointers to the fields of s matching snippetColumns, for Scan().
+func (s *Snippet) dest() []any {
+	return []any{&s.ID, &s.UserID, &s.OrganizationID, &s.Title, &s.Content, &s.Visibility, &s.Created, &s.Expires}
+}
 
-	// Get newly inserted ID
-	id, err := res.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
+// This function will insert a new snippet into the database.
+// A zero organizationID stores a personal snippet.
+func (m *SnippetModel) Insert(ctx context.Context, userID, organizationID int, title, content, visibility string, expires int) (int, error) {
+	query := `INSERT INTO snippets (user_id, organization_id, title, content, visibility, created, expires)
+	VALUES(?, NULLIF(?, 0), ?, ?, ?, ?, ?)`
 
-	return int(id), nil
+	created := now()
+	return m.DB.insert(ctx, query, userID, organizationID, title, content, visibility, created, created.AddDate(0, 0, expires))
 }
 
-// This will return a specific snippet based on its id.
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	query := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+// This will return a specific snippet based on its id, reading from a replica
+// when there is one.
+func (m *SnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	query := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE expires > ? AND id = ?`
 
-	row := m.DB.QueryRow(query, id)
+	row := m.DB.reader(ctx).QueryRowContext(ctx, query, now(), id)
 
 	// Initialize a pointer to a new zeroed Snippet struct.
 	s := &Snippet{}
 
 	// Convert the raw output from SQL to GO types.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(s.dest()...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// Encapsulate the model by return `ErrNoRecord` instead return `sql.ErrNoRows`.
@@ -68,12 +85,48 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	return s, nil
 }
 
-// This will return the 10 most recently created snippets
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	query := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+// This will return the 10 most recently created public snippets
+func (m *SnippetModel) Latest(ctx context.Context) ([]*Snippet, error) {
+	query := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE expires > ? AND visibility = ? ORDER BY id DESC LIMIT 10`
+
+	return m.list(ctx, query, now(), VisibilityPublic)
+}
+
+// This will return the unexpired snippets of an organization, whatever their
+// visibility. Only show them to members.
+func (m *SnippetModel) ForOrganization(ctx context.Context, organizationID int) ([]*Snippet, error) {
+	query := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE expires > ? AND organization_id = ? ORDER BY id DESC`
 
-	rows, err := m.DB.Query(query)
+	return m.list(ctx, query, now(), organizationID)
+}
+
+// This will return the 10 most recently created public snippets of a user.
+func (m *SnippetModel) ForUser(ctx context.Context, userID int) ([]*Snippet, error) {
+	query := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE expires > ? AND visibility = ? AND user_id = ? ORDER BY id DESC LIMIT 10`
+
+	return m.list(ctx, query, now(), VisibilityPublic, userID)
+}
+
+// This will return the 100 most recently created unexpired snippets of a
+// user, whatever their visibility, whose title or content contains query. All
+// of them match an empty query. Only show them to the user.
+func (m *SnippetModel) Search(ctx context.Context, userID int, query string) ([]*Snippet, error) {
+	escape := likeEscape(m.DB.Driver)
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE expires > ? AND user_id = ? AND (LOWER(title) LIKE ? ` + escape + ` OR LOWER(content) LIKE ? ` + escape + `)
+	ORDER BY id DESC LIMIT 100`
+
+	pattern := containsPattern(query)
+	return m.list(ctx, stmt, now(), userID, pattern, pattern)
+}
+
+// list runs a query returning snippetColumns and collects the rows. Like Get(),
+// it reads from a replica when there is one.
+func (m *SnippetModel) list(ctx context.Context, query string, args ...any) ([]*Snippet, error) {
+	rows, err := m.DB.reader(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +140,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 		// Create a pointer to a new zeored Snippet struct
 		s := &Snippet{}
 
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err := rows.Scan(s.dest()...)
 		if err != nil {
 			return nil, err
 		}
@@ -102,3 +155,70 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
 	return snippets, nil
 }
+
+// Delete removes the snippet with the given id.
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	query := `DELETE FROM snippets WHERE id = ?`
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// The methods below serve the admin commands of cmd/web rather than its
+// handlers, so they aren't part of SnippetModelInterface.
+
+// DeleteExpired removes the snippets which have expired, and returns how many
+// there were.
+func (m *SnippetModel) DeleteExpired(ctx context.Context) (int, error) {
+	query := `DELETE FROM snippets WHERE expires <= ?`
+
+	res, err := m.DB.ExecContext(ctx, query, now())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// All returns every unexpired snippet, oldest first.
+func (m *SnippetModel) All(ctx context.Context) ([]*Snippet, error) {
+	query := `SELECT ` + snippetColumns + ` FROM snippets WHERE expires > ? ORDER BY id`
+
+	return m.list(ctx, query, now())
+}
+
+// Import adds a snippet as it was exported by All(), keeping its creation and
+// expiry times, and returns its new ID. A snippet with the same author, title
+// and creation time is taken to be already there: Import returns
+// ErrDuplicateSnippet, so that an import can be run again.
+func (m *SnippetModel) Import(ctx context.Context, s *Snippet) (int, error) {
+	created := s.Created.UTC().Truncate(time.Second)
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT true FROM snippets WHERE COALESCE(user_id, 0) = ? AND title = ? AND created = ?)`
+	err := m.DB.QueryRowContext(ctx, query, s.UserID, s.Title, created).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, ErrDuplicateSnippet
+	}
+
+	query = `INSERT INTO snippets (user_id, organization_id, title, content, visibility, created, expires)
+	VALUES(NULLIF(?, 0), NULLIF(?, 0), ?, ?, ?, ?, ?)`
+
+	return m.DB.insert(ctx, query, s.UserID, s.OrganizationID, s.Title, s.Content, s.Visibility,
+		created, s.Expires.UTC().Truncate(time.Second))
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SnippetCache wraps a SnippetModelInterface, keeping the snippets returned by
+// Get() and the list returned by Latest() in memory for up to a TTL. No entry
+// outlives the expiry of the snippets in it, and any Insert() or Delete()
+// through the cache invalidates the entries it could affect. Changes made to
+// snippets any other way, such as deleting an account, must call Invalidate().
+//
+// The cache is local to the process: changes made by other instances are only
+// seen once the TTL is up.
+type SnippetCache struct {
+	SnippetModelInterface
+
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu sync.Mutex
+	// Snippets by id, with the most recently used at the front of order.
+	entries map[int]*list.Element
+	order   *list.List
+	latest  *latestEntry
+	// Bumped on every invalidation, so that a read which started before it
+	// doesn't store what may be a stale result.
+	generation uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type snippetEntry struct {
+	snippet *Snippet
+	expires time.Time
+}
+
+type latestEntry struct {
+	snippets []*Snippet
+	expires  time.Time
+}
+
+// CacheStats counts the lookups a cache could and couldn't answer.
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// NewSnippetCache returns a SnippetCache in front of model which holds up to
+// size snippets for up to ttl each.
+func NewSnippetCache(model SnippetModelInterface, size int, ttl time.Duration) *SnippetCache {
+	return &SnippetCache{
+		SnippetModelInterface: model,
+		size:                  size,
+		ttl:                   ttl,
+		now:                   time.Now,
+		entries:               make(map[int]*list.Element),
+		order:                 list.New(),
+	}
+}
+
+// Get returns the snippet from the cache, or reads it from the model.
+func (c *SnippetCache) Get(ctx context.Context, id int) (*Snippet, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[id]; ok {
+		entry := e.Value.(*snippetEntry)
+		if c.now().Before(entry.expires) {
+			c.order.MoveToFront(e)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return copySnippet(entry.snippet), nil
+		}
+		c.remove(e)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	s, err := c.SnippetModelInterface.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		c.store(s)
+	}
+
+	return copySnippet(s), nil
+}
+
+// Latest returns the latest snippets from the cache, or reads them from the
+// model.
+func (c *SnippetCache) Latest(ctx context.Context) ([]*Snippet, error) {
+	c.mu.Lock()
+	if c.latest != nil && c.now().Before(c.latest.expires) {
+		snippets := c.latest.snippets
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return copySnippets(snippets), nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	snippets, err := c.SnippetModelInterface.Latest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		// The list changes as soon as any snippet in it expires.
+		expires := c.now().Add(c.ttl)
+		for _, s := range snippets {
+			if s.Expires.Before(expires) {
+				expires = s.Expires
+			}
+		}
+		c.latest = &latestEntry{snippets: copySnippets(snippets), expires: expires}
+	}
+
+	return snippets, nil
+}
+
+// Insert adds a snippet through the model. A new snippet may belong in the
+// latest snippets, so they are dropped from the cache.
+func (c *SnippetCache) Insert(ctx context.Context, userID, organizationID int, title, content, visibility string, expires int) (int, error) {
+	id, err := c.SnippetModelInterface.Insert(ctx, userID, organizationID, title, content, visibility, expires)
+
+	c.mu.Lock()
+	c.generation++
+	c.latest = nil
+	c.mu.Unlock()
+
+	return id, err
+}
+
+// Delete removes a snippet through the model, and from the cache.
+func (c *SnippetCache) Delete(ctx context.Context, id int) error {
+	err := c.SnippetModelInterface.Delete(ctx, id)
+
+	c.mu.Lock()
+	c.generation++
+	c.latest = nil
+	if e, ok := c.entries[id]; ok {
+		c.remove(e)
+	}
+	c.mu.Unlock()
+
+	return err
+}
+
+// Invalidate drops everything from the cache, for changes to snippets which
+// don't go through it.
+func (c *SnippetCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.latest = nil
+	c.entries = make(map[int]*list.Element)
+	c.order.Init()
+}
+
+// Stats returns the number of cache hits and misses so far, and the number of
+// snippets held.
+func (c *SnippetCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+}
+
+// store caches s, evicting the least recently used snippet if the cache is
+// full. The caller must hold c.mu.
+func (c *SnippetCache) store(s *Snippet) {
+	expires := c.now().Add(c.ttl)
+	if s.Expires.Before(expires) {
+		expires = s.Expires
+	}
+	entry := &snippetEntry{snippet: copySnippet(s), expires: expires}
+
+	if e, ok := c.entries[s.ID]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[s.ID] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops an element from the cache. The caller must hold c.mu.
+func (c *SnippetCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*snippetEntry).snippet.ID)
+}
+
+// Cached snippets are copied on the way in and out, so that callers can't
+// change them for each other.
+func copySnippet(s *Snippet) *Snippet {
+	c := *s
+	return &c
+}
+
+func copySnippets(snippets []*Snippet) []*Snippet {
+	copies := make([]*Snippet, len(snippets))
+	for i, s := range snippets {
+		copies[i] = copySnippet(s)
+	}
+	return copies
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"testing"
+	"time"
+)
+
+// countingSnippetModel serves snippets from a map and counts the reads which
+// reach it.
+type countingSnippetModel struct {
+	SnippetModelInterface
+	snippets map[int]*Snippet
+	reads    int
+}
+
+func (m *countingSnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	m.reads++
+	s, ok := m.snippets[id]
+	if !ok {
+		return nil, ErrNoRecord
+	}
+	return s, nil
+}
+
+func (m *countingSnippetModel) Latest(ctx context.Context) ([]*Snippet, error) {
+	m.reads++
+	var snippets []*Snippet
+	for _, s := range m.snippets {
+		snippets = append(snippets, s)
+	}
+	return snippets, nil
+}
+
+func (m *countingSnippetModel) Insert(ctx context.Context, userID, organizationID int, title, content, visibility string, expires int) (int, error) {
+	return 0, nil
+}
+
+func (m *countingSnippetModel) Delete(ctx context.Context, id int) error {
+	delete(m.snippets, id)
+	return nil
+}
+
+func TestSnippetCache(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	newCache := func(size int) (*SnippetCache, *countingSnippetModel) {
+		model := &countingSnippetModel{snippets: map[int]*Snippet{
+			1: {ID: 1, Title: "One", Expires: clock.Add(24 * time.Hour)},
+			2: {ID: 2, Title: "Two", Expires: clock.Add(24 * time.Hour)},
+			3: {ID: 3, Title: "Three", Expires: clock.Add(30 * time.Second)},
+		}}
+		cache := NewSnippetCache(model, size, time.Minute)
+		cache.now = func() time.Time { return clock }
+		return cache, model
+	}
+
+	t.Run("Hits and misses", func(t *testing.T) {
+		cache, model := newCache(10)
+
+		cache.Get(ctx, 1)
+		s, err := cache.Get(ctx, 1)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, s.Title, "One")
+		assert.Equal(t, model.reads, 1)
+
+		_, err = cache.Get(ctx, 99)
+		assert.Equal(t, err, ErrNoRecord)
+
+		assert.Equal(t, cache.Stats(), CacheStats{Hits: 1, Misses: 2, Entries: 1})
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		cache, model := newCache(10)
+		defer func(start time.Time) { clock = start }(clock)
+
+		cache.Get(ctx, 1)
+		clock = clock.Add(time.Minute)
+		cache.Get(ctx, 1)
+		assert.Equal(t, model.reads, 2)
+	})
+
+	t.Run("Snippet expiry", func(t *testing.T) {
+		cache, model := newCache(10)
+		defer func(start time.Time) { clock = start }(clock)
+
+		cache.Get(ctx, 3)
+		cache.Latest(ctx)
+		clock = clock.Add(30 * time.Second)
+		cache.Get(ctx, 3)
+		cache.Latest(ctx)
+		assert.Equal(t, model.reads, 4)
+	})
+
+	t.Run("Size", func(t *testing.T) {
+		cache, model := newCache(2)
+
+		cache.Get(ctx, 1)
+		cache.Get(ctx, 2)
+		cache.Get(ctx, 1)
+		// Evicts 2, the least recently used.
+		cache.Get(ctx, 3)
+		assert.Equal(t, cache.Stats().Entries, 2)
+
+		cache.Get(ctx, 1)
+		assert.Equal(t, model.reads, 3)
+		cache.Get(ctx, 2)
+		assert.Equal(t, model.reads, 4)
+	})
+
+	t.Run("Invalidation", func(t *testing.T) {
+		cache, model := newCache(10)
+
+		cache.Get(ctx, 1)
+		cache.Latest(ctx)
+		cache.Insert(ctx, 1, 0, "Four", "", VisibilityPublic, 1)
+		cache.Latest(ctx)
+		assert.Equal(t, model.reads, 3)
+
+		cache.Delete(ctx, 1)
+		_, err := cache.Get(ctx, 1)
+		assert.Equal(t, err, ErrNoRecord)
+		cache.Latest(ctx)
+		assert.Equal(t, model.reads, 5)
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		cache, model := newCache(10)
+
+		cache.Get(ctx, 1)
+		cache.Get(ctx, 2)
+		cache.Latest(ctx)
+
+		// As when an account is deleted, the snippets change behind the
+		// cache's back.
+		model.snippets[1].UserID = 0
+		delete(model.snippets, 2)
+		cache.Invalidate()
+		assert.Equal(t, cache.Stats().Entries, 0)
+
+		s, err := cache.Get(ctx, 1)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, s.UserID, 0)
+		_, err = cache.Get(ctx, 2)
+		assert.Equal(t, err, ErrNoRecord)
+		cache.Latest(ctx)
+		assert.Equal(t, model.reads, 6)
+	})
+
+	t.Run("Copies", func(t *testing.T) {
+		cache, _ := newCache(10)
+
+		s, _ := cache.Get(ctx, 1)
+		s.Title = "Changed"
+		s, _ = cache.Get(ctx, 1)
+		assert.Equal(t, s.Title, "One")
+	})
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"testing"
+)
+
+func TestSnippetModelSearch(t *testing.T) {
+	db := newTestDB(t)
+	snippets := &SnippetModel{DB: db}
+	ctx := context.Background()
+
+	_, err := snippets.Insert(ctx, 1, 0, "Haiku", "An old silent pond", VisibilityPublic, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := snippets.Search(ctx, 1, "SILENT")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(found), 1)
+
+	found, err = snippets.Search(ctx, 2, "SILENT")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(found), 0)
+
+	// Wildcards in the query are matched literally.
+	for _, query := range []string{"100%", "%", "o_d"} {
+		found, err = snippets.Search(ctx, 1, query)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, len(found), 0)
+	}
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"time"
+)
+
+// Token scopes. A token is only ever valid for the purpose it was issued for.
+const (
+	ScopeEmailChange = "email-change"
+	// Personal tokens, with which users call the API.
+	ScopeAPI = "api"
+)
+
+type Token struct {
+	Plaintext string
+	Hash      []byte
+	UserID    int
+	Expiry    time.Time
+	Scope     string
+}
+
+// Wrap connection pool
+type TokenModel struct {
+	DB *DB
+}
+
+type TokenModelInterface interface {
+	New(ctx context.Context, userID int, ttl time.Duration, scope string) (*Token, error)
+	DeleteAllForUser(ctx context.Context, scope string, userID int) error
+}
+
+// generateToken creates a token with a random plaintext value. Only the
+// SHA-256 hash of the plaintext is stored in the database.
+func generateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+// New generates a token for the user and stores it in the "tokens" table.
+func (m *TokenModel) New(ctx context.Context, userID int, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope) VALUES(?, ?, ?, ?)`
+
+	_, err = m.DB.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry.UTC().Truncate(time.Second), token.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// DeleteAllForUser removes every token of the given scope issued to the user.
+func (m *TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int) error {
+	query := `DELETE FROM tokens WHERE scope = ? AND user_id = ?`
+
+	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	return err
+}
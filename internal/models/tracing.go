@@ -0,0 +1,326 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// Spans are started with the global tracer provider, which does nothing until
+// the application installs one.
+var tracer = otel.Tracer("github.com/minhnghia2k3/snippet_box/internal/models")
+
+// traced runs fn in a child span of ctx named after the model method. Errors
+// are recorded on the span, except for the ones which callers expect and
+// handle, such as ErrNoRecord.
+func traced[T any](ctx context.Context, name string, fn func(context.Context) (T, error), attrs ...attribute.KeyValue) (T, error) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	defer span.End()
+
+	v, err := fn(ctx)
+	if err != nil && !expectedError(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return v, err
+}
+
+// tracedErr is traced for methods which only return an error.
+func tracedErr(ctx context.Context, name string, fn func(context.Context) error, attrs ...attribute.KeyValue) error {
+	_, err := traced(ctx, name, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, attrs...)
+	return err
+}
+
+func expectedError(err error) bool {
+	return errors.Is(err, ErrNoRecord) ||
+		errors.Is(err, ErrInvalidCredentials) ||
+		errors.Is(err, ErrDuplicateEmail) ||
+		errors.Is(err, ErrAccountDisabled)
+}
+
+// TracedSnippetModel wraps a SnippetModelInterface, tracing every call to it.
+type TracedSnippetModel struct {
+	SnippetModelInterface
+}
+
+func (m *TracedSnippetModel) Insert(ctx context.Context, userID, organizationID int, title, content, visibility string, expires int) (int, error) {
+	return traced(ctx, "SnippetModel.Insert", func(ctx context.Context) (int, error) {
+		return m.SnippetModelInterface.Insert(ctx, userID, organizationID, title, content, visibility, expires)
+	}, attribute.Int("user.id", userID))
+}
+
+func (m *TracedSnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	return traced(ctx, "SnippetModel.Get", func(ctx context.Context) (*Snippet, error) {
+		return m.SnippetModelInterface.Get(ctx, id)
+	}, attribute.Int("snippet.id", id))
+}
+
+func (m *TracedSnippetModel) Latest(ctx context.Context) ([]*Snippet, error) {
+	return traced(ctx, "SnippetModel.Latest", m.SnippetModelInterface.Latest)
+}
+
+func (m *TracedSnippetModel) ForOrganization(ctx context.Context, organizationID int) ([]*Snippet, error) {
+	return traced(ctx, "SnippetModel.ForOrganization", func(ctx context.Context) ([]*Snippet, error) {
+		return m.SnippetModelInterface.ForOrganization(ctx, organizationID)
+	}, attribute.Int("organization.id", organizationID))
+}
+
+func (m *TracedSnippetModel) ForUser(ctx context.Context, userID int) ([]*Snippet, error) {
+	return traced(ctx, "SnippetModel.ForUser", func(ctx context.Context) ([]*Snippet, error) {
+		return m.SnippetModelInterface.ForUser(ctx, userID)
+	}, attribute.Int("user.id", userID))
+}
+
+func (m *TracedSnippetModel) Search(ctx context.Context, userID int, query string) ([]*Snippet, error) {
+	return traced(ctx, "SnippetModel.Search", func(ctx context.Context) ([]*Snippet, error) {
+		return m.SnippetModelInterface.Search(ctx, userID, query)
+	}, attribute.Int("user.id", userID))
+}
+
+func (m *TracedSnippetModel) Delete(ctx context.Context, id int) error {
+	return tracedErr(ctx, "SnippetModel.Delete", func(ctx context.Context) error {
+		return m.SnippetModelInterface.Delete(ctx, id)
+	}, attribute.Int("snippet.id", id))
+}
+
+// TracedUserModel wraps a UserModelInterface, tracing every call to it.
+type TracedUserModel struct {
+	UserModelInterface
+}
+
+func (m *TracedUserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
+	return traced(ctx, "UserModel.Insert", func(ctx context.Context) (int, error) {
+		return m.UserModelInterface.Insert(ctx, name, email, password)
+	})
+}
+
+func (m *TracedUserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	return traced(ctx, "UserModel.Authenticate", func(ctx context.Context) (int, error) {
+		return m.UserModelInterface.Authenticate(ctx, email, password)
+	})
+}
+
+func (m *TracedUserModel) Exists(ctx context.Context, id int) (bool, error) {
+	return traced(ctx, "UserModel.Exists", func(ctx context.Context) (bool, error) {
+		return m.UserModelInterface.Exists(ctx, id)
+	}, attribute.Int("user.id", id))
+}
+
+func (m *TracedUserModel) Get(ctx context.Context, id int) (*User, error) {
+	return traced(ctx, "UserModel.Get", func(ctx context.Context) (*User, error) {
+		return m.UserModelInterface.Get(ctx, id)
+	}, attribute.Int("user.id", id))
+}
+
+func (m *TracedUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return traced(ctx, "UserModel.GetByEmail", func(ctx context.Context) (*User, error) {
+		return m.UserModelInterface.GetByEmail(ctx, email)
+	})
+}
+
+func (m *TracedUserModel) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	return traced(ctx, "UserModel.GetForToken", func(ctx context.Context) (*User, error) {
+		return m.UserModelInterface.GetForToken(ctx, scope, tokenPlaintext)
+	}, attribute.String("token.scope", scope))
+}
+
+func (m *TracedUserModel) PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) error {
+	return tracedErr(ctx, "UserModel.PasswordUpdate", func(ctx context.Context) error {
+		return m.UserModelInterface.PasswordUpdate(ctx, id, currentPassword, newPassword)
+	}, attribute.Int("user.id", id))
+}
+
+func (m *TracedUserModel) UpdateName(ctx context.Context, id int, name string) error {
+	return tracedErr(ctx, "UserModel.UpdateName", func(ctx context.Context) error {
+		return m.UserModelInterface.UpdateName(ctx, id, name)
+	}, attribute.Int("user.id", id))
+}
+
+func (m *TracedUserModel) SetPendingEmail(ctx context.Context, id int, email string) error {
+	return tracedErr(ctx, "UserModel.SetPendingEmail", func(ctx context.Context) error {
+		return m.UserModelInterface.SetPendingEmail(ctx, id, email)
+	}, attribute.Int("user.id", id))
+}
+
+func (m *TracedUserModel) ConfirmEmail(ctx context.Context, tokenPlaintext string) error {
+	return tracedErr(ctx, "UserModel.ConfirmEmail", func(ctx context.Context) error {
+		return m.UserModelInterface.ConfirmEmail(ctx, tokenPlaintext)
+	})
+}
+
+func (m *TracedUserModel) Delete(ctx context.Context, id int, password string, deleteSnippets bool) error {
+	return tracedErr(ctx, "UserModel.Delete", func(ctx context.Context) error {
+		return m.UserModelInterface.Delete(ctx, id, password, deleteSnippets)
+	}, attribute.Int("user.id", id))
+}
+
+func (m *TracedUserModel) Search(ctx context.Context, query string) ([]*User, error) {
+	return traced(ctx, "UserModel.Search", func(ctx context.Context) ([]*User, error) {
+		return m.UserModelInterface.Search(ctx, query)
+	})
+}
+
+func (m *TracedUserModel) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	return tracedErr(ctx, "UserModel.SetDisabled", func(ctx context.Context) error {
+		return m.UserModelInterface.SetDisabled(ctx, id, disabled)
+	}, attribute.Int("user.id", id))
+}
+
+func (m *TracedUserModel) RequirePasswordReset(ctx context.Context, id int) error {
+	return tracedErr(ctx, "UserModel.RequirePasswordReset", func(ctx context.Context) error {
+		return m.UserModelInterface.RequirePasswordReset(ctx, id)
+	}, attribute.Int("user.id", id))
+}
+
+// TracedAuditModel wraps an AuditModelInterface, tracing every call to it.
+type TracedAuditModel struct {
+	AuditModelInterface
+}
+
+func (m *TracedAuditModel) Insert(ctx context.Context, e *AuditEvent) error {
+	return tracedErr(ctx, "AuditModel.Insert", func(ctx context.Context) error {
+		return m.AuditModelInterface.Insert(ctx, e)
+	}, attribute.String("audit.action", e.Action))
+}
+
+func (m *TracedAuditModel) Search(ctx context.Context, filter AuditFilter) ([]*AuditEvent, error) {
+	return traced(ctx, "AuditModel.Search", func(ctx context.Context) ([]*AuditEvent, error) {
+		return m.AuditModelInterface.Search(ctx, filter)
+	})
+}
+
+// TracedWebhookModel wraps a WebhookModelInterface, tracing every call to it.
+type TracedWebhookModel struct {
+	WebhookModelInterface
+}
+
+func (m *TracedWebhookModel) Insert(ctx context.Context, userID int, url string) (*Webhook, error) {
+	return traced(ctx, "WebhookModel.Insert", func(ctx context.Context) (*Webhook, error) {
+		return m.WebhookModelInterface.Insert(ctx, userID, url)
+	}, attribute.Int("user.id", userID))
+}
+
+func (m *TracedWebhookModel) Get(ctx context.Context, id int) (*Webhook, error) {
+	return traced(ctx, "WebhookModel.Get", func(ctx context.Context) (*Webhook, error) {
+		return m.WebhookModelInterface.Get(ctx, id)
+	}, attribute.Int("webhook.id", id))
+}
+
+func (m *TracedWebhookModel) ForUser(ctx context.Context, userID int) ([]*Webhook, error) {
+	return traced(ctx, "WebhookModel.ForUser", func(ctx context.Context) ([]*Webhook, error) {
+		return m.WebhookModelInterface.ForUser(ctx, userID)
+	}, attribute.Int("user.id", userID))
+}
+
+func (m *TracedWebhookModel) Delete(ctx context.Context, id int) error {
+	return tracedErr(ctx, "WebhookModel.Delete", func(ctx context.Context) error {
+		return m.WebhookModelInterface.Delete(ctx, id)
+	}, attribute.Int("webhook.id", id))
+}
+
+func (m *TracedWebhookModel) Enqueue(ctx context.Context, userID int, event string, payload []byte) (int, error) {
+	return traced(ctx, "WebhookModel.Enqueue", func(ctx context.Context) (int, error) {
+		return m.WebhookModelInterface.Enqueue(ctx, userID, event, payload)
+	}, attribute.Int("user.id", userID), attribute.String("webhook.event", event))
+}
+
+func (m *TracedWebhookModel) Deliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error) {
+	return traced(ctx, "WebhookModel.Deliveries", func(ctx context.Context) ([]*WebhookDelivery, error) {
+		return m.WebhookModelInterface.Deliveries(ctx, webhookID)
+	}, attribute.Int("webhook.id", webhookID))
+}
+
+func (m *TracedWebhookModel) Redeliver(ctx context.Context, webhookID, deliveryID int) error {
+	return tracedErr(ctx, "WebhookModel.Redeliver", func(ctx context.Context) error {
+		return m.WebhookModelInterface.Redeliver(ctx, webhookID, deliveryID)
+	}, attribute.Int("webhook.id", webhookID), attribute.Int("webhook.delivery.id", deliveryID))
+}
+
+func (m *TracedWebhookModel) Due(ctx context.Context, limit int) ([]*WebhookDelivery, error) {
+	return traced(ctx, "WebhookModel.Due", func(ctx context.Context) ([]*WebhookDelivery, error) {
+		return m.WebhookModelInterface.Due(ctx, limit)
+	})
+}
+
+func (m *TracedWebhookModel) Claim(ctx context.Context, d *WebhookDelivery, until time.Time) (bool, error) {
+	return traced(ctx, "WebhookModel.Claim", func(ctx context.Context) (bool, error) {
+		return m.WebhookModelInterface.Claim(ctx, d, until)
+	}, attribute.Int("webhook.delivery.id", d.ID))
+}
+
+func (m *TracedWebhookModel) Finish(ctx context.Context, d *WebhookDelivery) error {
+	return tracedErr(ctx, "WebhookModel.Finish", func(ctx context.Context) error {
+		return m.WebhookModelInterface.Finish(ctx, d)
+	}, attribute.Int("webhook.delivery.id", d.ID), attribute.String("webhook.delivery.status", d.Status))
+}
+
+// TracedTokenModel wraps a TokenModelInterface, tracing every call to it.
+type TracedTokenModel struct {
+	TokenModelInterface
+}
+
+func (m *TracedTokenModel) New(ctx context.Context, userID int, ttl time.Duration, scope string) (*Token, error) {
+	return traced(ctx, "TokenModel.New", func(ctx context.Context) (*Token, error) {
+		return m.TokenModelInterface.New(ctx, userID, ttl, scope)
+	}, attribute.Int("user.id", userID), attribute.String("token.scope", scope))
+}
+
+func (m *TracedTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int) error {
+	return tracedErr(ctx, "TokenModel.DeleteAllForUser", func(ctx context.Context) error {
+		return m.TokenModelInterface.DeleteAllForUser(ctx, scope, userID)
+	}, attribute.Int("user.id", userID), attribute.String("token.scope", scope))
+}
+
+// TracedOrganizationModel wraps an OrganizationModelInterface, tracing every
+// call to it.
+type TracedOrganizationModel struct {
+	OrganizationModelInterface
+}
+
+func (m *TracedOrganizationModel) Insert(ctx context.Context, name string, ownerID int) (int, error) {
+	return traced(ctx, "OrganizationModel.Insert", func(ctx context.Context) (int, error) {
+		return m.OrganizationModelInterface.Insert(ctx, name, ownerID)
+	}, attribute.Int("user.id", ownerID))
+}
+
+func (m *TracedOrganizationModel) Get(ctx context.Context, id int) (*Organization, error) {
+	return traced(ctx, "OrganizationModel.Get", func(ctx context.Context) (*Organization, error) {
+		return m.OrganizationModelInterface.Get(ctx, id)
+	}, attribute.Int("organization.id", id))
+}
+
+func (m *TracedOrganizationModel) ForUser(ctx context.Context, userID int) ([]*Organization, error) {
+	return traced(ctx, "OrganizationModel.ForUser", func(ctx context.Context) ([]*Organization, error) {
+		return m.OrganizationModelInterface.ForUser(ctx, userID)
+	}, attribute.Int("user.id", userID))
+}
+
+func (m *TracedOrganizationModel) Members(ctx context.Context, id int) ([]*OrganizationMember, error) {
+	return traced(ctx, "OrganizationModel.Members", func(ctx context.Context) ([]*OrganizationMember, error) {
+		return m.OrganizationModelInterface.Members(ctx, id)
+	}, attribute.Int("organization.id", id))
+}
+
+func (m *TracedOrganizationModel) MemberRole(ctx context.Context, id, userID int) (string, error) {
+	return traced(ctx, "OrganizationModel.MemberRole", func(ctx context.Context) (string, error) {
+		return m.OrganizationModelInterface.MemberRole(ctx, id, userID)
+	}, attribute.Int("organization.id", id), attribute.Int("user.id", userID))
+}
+
+func (m *TracedOrganizationModel) AddMember(ctx context.Context, id, userID int, role string) error {
+	return tracedErr(ctx, "OrganizationModel.AddMember", func(ctx context.Context) error {
+		return m.OrganizationModelInterface.AddMember(ctx, id, userID, role)
+	}, attribute.Int("organization.id", id), attribute.Int("user.id", userID))
+}
+
+func (m *TracedOrganizationModel) RemoveMember(ctx context.Context, id, userID int) error {
+	return tracedErr(ctx, "OrganizationModel.RemoveMember", func(ctx context.Context) error {
+		return m.OrganizationModelInterface.RemoveMember(ctx, id, userID)
+	}, attribute.Int("organization.id", id), attribute.Int("user.id", userID))
+}
@@ -1,66 +1,123 @@
 package models
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 	"strings"
 	"time"
 )
 
+// User roles.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID           int
 	Name         string
 	Email        string
 	HashPassword []byte
 	Created      time.Time
+	// New email address waiting to be confirmed, if any.
+	PendingEmail string
+	Role         string
+	Disabled     bool
+	// Set by an administrator to make the user pick a new password.
+	PasswordResetRequired bool
 }
 
 // Wrap connection pool
 type UserModel struct {
-	DB *sql.DB
+	DB *DB
+	// Cost of the bcrypt password hashes. Zero means defaultBcryptCost.
+	BcryptCost int
 }
 
+const defaultBcryptCost = 12
+
 type UserModelInterface interface {
-	Insert(name, email, password string) error
-	Authenticate(email, password string) (int, error)
-	Exists(id int) (bool, error)
-	Get(id int) (*User, error)
-	PasswordUpdate(id int, currentPassword, newPassword string) error
+	Insert(ctx context.Context, name, email, password string) (int, error)
+	Authenticate(ctx context.Context, email, password string) (int, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	Get(ctx context.Context, id int) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error)
+	PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) error
+	UpdateName(ctx context.Context, id int, name string) error
+	SetPendingEmail(ctx context.Context, id int, email string) error
+	ConfirmEmail(ctx context.Context, tokenPlaintext string) error
+	Delete(ctx context.Context, id int, password string, deleteSnippets bool) error
+	Search(ctx context.Context, query string) ([]*User, error)
+	SetDisabled(ctx context.Context, id int, disabled bool) error
+	RequirePasswordReset(ctx context.Context, id int) error
 }
 
-// Add a new record to the "user" table.
-func (m *UserModel) Insert(name, email, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+// Add a new record to the "user" table, returning its ID.
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), m.bcryptCost())
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	sql := `INSERT INTO users (name, email, hashed_password, created)
-VALUES(?, ?, ?, UTC_TIMESTAMP())`
+VALUES(?, ?, ?, ?)`
 
-	_, err = m.DB.Exec(sql, name, email, string(hashedPassword))
+	id, err := m.DB.insert(ctx, sql, name, email, string(hashedPassword), now())
 	if err != nil {
-		var mySQLError *mysql.MySQLError
 		// Check for duplicate email error.
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users.unique_email") {
-				return ErrDuplicateEmail
-			}
+		if isDuplicateEmail(err) {
+			return 0, ErrDuplicateEmail
 		}
-		return err
+		return 0, err
 	}
-	return nil
+	return id, nil
+}
+
+// isDuplicateEmail reports whether err is a violation of the unique_email
+// constraint on the users table, as reported by any of the supported drivers.
+func isDuplicateEmail(err error) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users.unique_email")
+	}
+
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) {
+		// 23505 is unique_violation.
+		return pgError.Code == "23505" && pgError.ConstraintName == "unique_email"
+	}
+
+	// SQLite doesn't name the constraint in its errors, only the columns.
+	var sqliteError *sqlite.Error
+	if errors.As(err, &sqliteError) {
+		return sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(sqliteError.Error(), "users.email")
+	}
+
+	return false
+}
+
+func (m *UserModel) bcryptCost() int {
+	if m.BcryptCost == 0 {
+		return defaultBcryptCost
+	}
+	return m.BcryptCost
 }
 
 // Authenticate() method to verify user exists with valid credentials?
-func (m *UserModel) Authenticate(email, password string) (int, error) {
-	query := `SELECT id, hashed_password from users WHERE email = ?`
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	query := `SELECT id, hashed_password, disabled from users WHERE email = ?`
 	u := &User{}
 	// Get & Check email address from users table
-	err := m.DB.QueryRow(query, email).Scan(&u.ID, &u.HashPassword)
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&u.ID, &u.HashPassword, &u.Disabled)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -78,29 +135,43 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
+	// Only tell a disabled user about it once they proved who they are.
+	if u.Disabled {
+		return 0, ErrAccountDisabled
+	}
+
 	// Return user id.
 	return u.ID, nil
 }
 
 // Exists method to check if user exists with specific ID.
-func (m *UserModel) Exists(id int) (bool, error) {
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
 	var exist bool
 
 	query := `SELECT EXISTS(SELECT true FROM users WHERE id =?)`
 
-	err := m.DB.QueryRow(query, id).Scan(&exist)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&exist)
 
 	return exist, err
 }
 
+// The columns read into a User by the queries below, in the order expected by
+// User.dest().
+const userColumns = `id, name, email, created, COALESCE(pending_email, ''), role, disabled, password_reset_required`
+
+// dest returns pointers to the fields of u matching userColumns, for Scan().
+func (u *User) dest() []any {
+	return []any{&u.ID, &u.Name, &u.Email, &u.Created, &u.PendingEmail, &u.Role, &u.Disabled, &u.PasswordResetRequired}
+}
+
 // Accept ID of a user, and return a pointer to a User struct.
-func (m *UserModel) Get(id int) (*User, error) {
+func (m *UserModel) Get(ctx context.Context, id int) (*User, error) {
 	var user User
-	query := `SELECT name, email, created FROM users WHERE id = ?`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
 
-	err := m.DB.QueryRow(query, id).Scan(&user.Name, &user.Email, &user.Created)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(user.dest()...)
 	if err != nil {
-		if errors.Is(err, ErrNoRecord) {
+		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
 		} else {
 			return nil, err
@@ -110,11 +181,27 @@ func (m *UserModel) Get(id int) (*User, error) {
 	return &user, nil
 }
 
-func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
+// Accept an email address, and return a pointer to the matching User struct.
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = ?`
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(user.dest()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (m *UserModel) PasswordUpdate(ctx context.Context, id int, currentPassword, newPassword string) error {
 	var user User
 	// Check if currentPassword = hashed password
 	query := `SELECT hashed_password FROM users WHERE id = ?`
-	err := m.DB.QueryRow(query, id).Scan(&user.HashPassword)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.HashPassword)
 	if err != nil {
 		return err
 	}
@@ -127,15 +214,267 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 		}
 	}
 	// Hash new Password and store into the db
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), m.bcryptCost())
 	if err != nil {
 		return err
 	}
 
-	query = `UPDATE users SET hashed_password = ? WHERE id = ?`
-	_, err = m.DB.Exec(query, hashedPassword, id)
+	query = `UPDATE users SET hashed_password = ?, password_reset_required = FALSE WHERE id = ?`
+	_, err = m.DB.ExecContext(ctx, query, hashedPassword, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// UpdateName changes the display name of the user.
+func (m *UserModel) UpdateName(ctx context.Context, id int, name string) error {
+	query := `UPDATE users SET name = ? WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, query, name, id)
+	return err
+}
+
+// SetPendingEmail records a new email address for the user. It only replaces
+// the current address once confirmed with ConfirmEmail().
+func (m *UserModel) SetPendingEmail(ctx context.Context, id int, email string) error {
+	query := `UPDATE users SET pending_email = ? WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, query, email, id)
+	return err
+}
+
+// GetForToken returns the user who was issued the given token of the given
+// scope, or ErrNoRecord if there is no such token or it has expired.
+func (m *UserModel) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `SELECT ` + userColumns + ` FROM users
+	INNER JOIN tokens ON users.id = tokens.user_id
+	WHERE tokens.hash = ? AND tokens.scope = ? AND tokens.expiry > ?`
+
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, hash[:], scope, now()).Scan(user.dest()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ConfirmEmail swaps in the pending email address of the user who was issued
+// the given email-change token, and uses up their email-change tokens.
+func (m *UserModel) ConfirmEmail(ctx context.Context, tokenPlaintext string) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT users.id, users.pending_email FROM users
+	INNER JOIN tokens ON users.id = tokens.user_id
+	WHERE tokens.hash = ? AND tokens.scope = ? AND tokens.expiry > ?`
+
+	var id int
+	var pendingEmail sql.NullString
+	err = tx.QueryRowContext(ctx, query, hash[:], ScopeEmailChange, now()).Scan(&id, &pendingEmail)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	if !pendingEmail.Valid {
+		return ErrNoRecord
+	}
+
+	query = `UPDATE users SET email = ?, pending_email = NULL WHERE id = ?`
+	_, err = tx.ExecContext(ctx, query, pendingEmail.String, id)
+	if err != nil {
+		if isDuplicateEmail(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	query = `DELETE FROM tokens WHERE scope = ? AND user_id = ?`
+	_, err = tx.ExecContext(ctx, query, ScopeEmailChange, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes the user after checking their password. Their snippets are
+// either deleted as well, or kept without an owner.
+func (m *UserModel) Delete(ctx context.Context, id int, password string, deleteSnippets bool) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hashedPassword []byte
+	query := `SELECT hashed_password FROM users WHERE id = ?`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	if deleteSnippets {
+		query = `DELETE FROM snippets WHERE user_id = ?`
+	} else {
+		query = `UPDATE snippets SET user_id = NULL WHERE user_id = ?`
+	}
+
+	statements := []string{
+		query,
+		`DELETE FROM tokens WHERE user_id = ?`,
+		`DELETE FROM users WHERE id = ?`,
+	}
+	for _, stmt := range statements {
+		_, err = tx.ExecContext(ctx, stmt, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Search returns up to 50 users whose name or email contains query, or the
+// first 50 users if query is empty.
+func (m *UserModel) Search(ctx context.Context, query string) ([]*User, error) {
+	escape := likeEscape(m.DB.Driver)
+	stmt := `SELECT ` + userColumns + ` FROM users
+	WHERE LOWER(name) LIKE ? ` + escape + ` OR LOWER(email) LIKE ? ` + escape + ` ORDER BY id LIMIT 50`
+
+	pattern := containsPattern(query)
+	rows, err := m.DB.QueryContext(ctx, stmt, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		err := rows.Scan(u.dest()...)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetDisabled disables or re-enables the user. Disabled users can't log in.
+func (m *UserModel) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	query := `UPDATE users SET disabled = ? WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, query, disabled, id)
+	return err
+}
+
+// RequirePasswordReset makes the user choose a new password before they can
+// do anything else.
+func (m *UserModel) RequirePasswordReset(ctx context.Context, id int) error {
+	query := `UPDATE users SET password_reset_required = TRUE WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// The methods below serve the admin commands of cmd/web rather than its
+// handlers, so they aren't part of UserModelInterface.
+
+// SetPassword replaces the user's password, without asking for the current
+// one. The user no longer has to choose a new one: call RequirePasswordReset()
+// afterwards for a temporary password.
+func (m *UserModel) SetPassword(ctx context.Context, id int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), m.bcryptCost())
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET hashed_password = ?, password_reset_required = FALSE WHERE id = ?`
+
+	_, err = m.DB.ExecContext(ctx, query, string(hashedPassword), id)
+	return err
+}
+
+// SetRole gives the user a role, RoleUser or RoleAdmin.
+func (m *UserModel) SetRole(ctx context.Context, id int, role string) error {
+	query := `UPDATE users SET role = ? WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, query, role, id)
+	return err
+}
+
+// All returns every user, with their password hash, oldest first.
+func (m *UserModel) All(ctx context.Context) ([]*User, error) {
+	query := `SELECT ` + userColumns + `, hashed_password FROM users ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		var hashedPassword string
+		err := rows.Scan(append(u.dest(), &hashedPassword)...)
+		if err != nil {
+			return nil, err
+		}
+		u.HashPassword = []byte(hashedPassword)
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Import adds a user as they were exported by All(), keeping their password
+// hash, role and creation time, and returns their new ID.
+func (m *UserModel) Import(ctx context.Context, u *User) (int, error) {
+	query := `INSERT INTO users (name, email, hashed_password, created, role, disabled, password_reset_required)
+	VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	id, err := m.DB.insert(ctx, query, u.Name, u.Email, string(u.HashPassword), u.Created.UTC().Truncate(time.Second),
+		u.Role, u.Disabled, u.PasswordResetRequired)
+	if err != nil {
+		if isDuplicateEmail(err) {
+			return 0, ErrDuplicateEmail
+		}
+		return 0, err
+	}
+	return id, nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestUserModel(t *testing.T) {
+	db := newTestDB(t)
+	users := &UserModel{DB: db}
+	ctx := context.Background()
+
+	t.Run("Insert", func(t *testing.T) {
+		_, err := users.Insert(ctx, "Alice", "alice@example.com", "pa$$word")
+		assert.Equal(t, err, nil)
+
+		_, err = users.Insert(ctx, "Alice", "alice@example.com", "pa$$word")
+		assert.Equal(t, err, ErrDuplicateEmail)
+	})
+
+	t.Run("GetForToken", func(t *testing.T) {
+		token, err := (&TokenModel{DB: db}).New(ctx, 1, time.Hour, ScopeAPI)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := users.GetForToken(ctx, ScopeAPI, token.Plaintext)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, user.ID, 1)
+
+		_, err = users.GetForToken(ctx, ScopeEmailChange, token.Plaintext)
+		assert.Equal(t, err, ErrNoRecord)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		_, err := users.Insert(ctx, "Bob_Smith", "bob@example.com", "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			query string
+			want  int
+		}{
+			{query: "", want: 2},
+			{query: "ALICE", want: 1},
+			{query: "%", want: 0},
+			{query: "b_b", want: 0},
+			{query: "B_S", want: 1},
+			{query: `\`, want: 0},
+		}
+
+		for _, tt := range tests {
+			found, err := users.Search(ctx, tt.query)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, len(found), tt.want)
+		}
+	})
+}
@@ -0,0 +1,306 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a URL which is sent the events of a user's snippets, signed
+// with the secret.
+type Webhook struct {
+	ID      int
+	UserID  int
+	URL     string
+	Secret  string
+	Created time.Time
+}
+
+// WebhookDelivery is an event to send to a webhook, and how sending it went.
+// Pending deliveries are sent once NextAttempt has passed.
+type WebhookDelivery struct {
+	ID             int
+	WebhookID      int
+	Event          string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	ResponseStatus int
+	Error          string
+	NextAttempt    time.Time
+	Created        time.Time
+	// The webhook's URL and secret, filled in by Due().
+	URL    string
+	Secret string
+}
+
+// Wrap connection pool
+type WebhookModel struct {
+	DB *DB
+}
+
+type WebhookModelInterface interface {
+	Insert(ctx context.Context, userID int, url string) (*Webhook, error)
+	Get(ctx context.Context, id int) (*Webhook, error)
+	ForUser(ctx context.Context, userID int) ([]*Webhook, error)
+	Delete(ctx context.Context, id int) error
+	Enqueue(ctx context.Context, userID int, event string, payload []byte) (int, error)
+	Deliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error)
+	Redeliver(ctx context.Context, webhookID, deliveryID int) error
+	Due(ctx context.Context, limit int) ([]*WebhookDelivery, error)
+	Claim(ctx context.Context, d *WebhookDelivery, until time.Time) (bool, error)
+	Finish(ctx context.Context, d *WebhookDelivery) error
+}
+
+const webhookColumns = `id, user_id, url, secret, created`
+
+func (w *Webhook) dest() []any {
+	return []any{&w.ID, &w.UserID, &w.URL, &w.Secret, &w.Created}
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_status, d.error, d.next_attempt, d.created`
+
+func (d *WebhookDelivery) dest() []any {
+	return []any{&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseStatus, &d.Error, &d.NextAttempt, &d.Created}
+}
+
+// Insert registers url as a webhook of the user, with a new random secret.
+func (m *WebhookModel) Insert(ctx context.Context, userID int, url string) (*Webhook, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Webhook{UserID: userID, URL: url, Secret: hex.EncodeToString(secret), Created: now()}
+
+	query := `INSERT INTO webhooks (user_id, url, secret, created) VALUES (?, ?, ?, ?)`
+	w.ID, err = m.DB.insert(ctx, query, w.UserID, w.URL, w.Secret, w.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Get returns the webhook with the given id, or ErrNoRecord.
+func (m *WebhookModel) Get(ctx context.Context, id int) (*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = ?`
+
+	w := &Webhook{}
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(w.dest()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// ForUser returns the webhooks of a user, oldest first.
+func (m *WebhookModel) ForUser(ctx context.Context, userID int) ([]*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = ? ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		w := &Webhook{}
+		err := rows.Scan(w.dest()...)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes a webhook along with its deliveries.
+func (m *WebhookModel) Delete(ctx context.Context, id int) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return tx.Commit()
+}
+
+// Enqueue queues an event for delivery to every webhook of the user, and
+// returns the number of deliveries queued.
+func (m *WebhookModel) Enqueue(ctx context.Context, userID int, event string, payload []byte) (int, error) {
+	webhooks, err := m.ForUser(ctx, userID)
+	if err != nil || len(webhooks) == 0 {
+		return 0, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, w := range webhooks {
+		err = enqueue(ctx, tx, w.ID, event, payload)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(webhooks), tx.Commit()
+}
+
+// The statements are kept to plain INSERTs: PostgreSQL can't tell the types
+// of placeholders in the select list of an INSERT ... SELECT.
+func enqueue(ctx context.Context, q querier, webhookID int, event string, payload []byte) error {
+	query := `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt, created)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	t := now()
+	_, err := q.ExecContext(ctx, query, webhookID, event, string(payload), DeliveryPending, t, t)
+	return err
+}
+
+// Deliveries returns the 50 latest deliveries to a webhook, the latest first.
+func (m *WebhookModel) Deliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries d
+	WHERE d.webhook_id = ? ORDER BY d.id DESC LIMIT 50`
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		err := rows.Scan(d.dest()...)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver queues the payload of a past delivery to the webhook again, as a
+// new delivery.
+func (m *WebhookModel) Redeliver(ctx context.Context, webhookID, deliveryID int) error {
+	query := `SELECT event, payload FROM webhook_deliveries WHERE id = ? AND webhook_id = ?`
+
+	var event string
+	var payload []byte
+	err := m.DB.QueryRowContext(ctx, query, deliveryID, webhookID).Scan(&event, &payload)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	return enqueue(ctx, m.DB, webhookID, event, payload)
+}
+
+// Due returns up to limit pending deliveries whose next attempt has come,
+// with the URL and secret of their webhook.
+func (m *WebhookModel) Due(ctx context.Context, limit int) ([]*WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + `, w.url, w.secret
+	FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+	WHERE d.status = ? AND d.next_attempt <= ? ORDER BY d.next_attempt LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, query, DeliveryPending, now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		err := rows.Scan(append(d.dest(), &d.URL, &d.Secret)...)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Claim holds a due delivery back from other workers until the given time,
+// while it is being sent. It reports false if another worker got to it first.
+func (m *WebhookModel) Claim(ctx context.Context, d *WebhookDelivery, until time.Time) (bool, error) {
+	query := `UPDATE webhook_deliveries SET next_attempt = ?
+	WHERE id = ? AND status = ? AND attempts = ? AND next_attempt <= ?`
+
+	res, err := m.DB.ExecContext(ctx, query, until.UTC().Truncate(time.Second), d.ID, DeliveryPending, d.Attempts, now())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Finish records the outcome of an attempt to send a delivery: its status,
+// attempts, response status, error and, if it is still pending, next attempt.
+func (m *WebhookModel) Finish(ctx context.Context, d *WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries
+	SET status = ?, attempts = ?, response_status = ?, error = ?, next_attempt = ?
+	WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, query, d.Status, d.Attempts, d.ResponseStatus, truncate(d.Error, 255),
+		d.NextAttempt.UTC().Truncate(time.Second), d.ID)
+	return err
+}
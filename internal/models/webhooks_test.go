@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"github.com/minhnghia2k3/snippet_box/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestWebhookModelDeliveries(t *testing.T) {
+	webhooks := &WebhookModel{DB: newTestDB(t)}
+	ctx := context.Background()
+
+	webhook, err := webhooks.Insert(ctx, 1, "https://example.com/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events are queued for every webhook of the user.
+	n, err := webhooks.Enqueue(ctx, 1, "snippet.created", []byte(`{}`))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 1)
+
+	due, err := webhooks.Due(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("got %d due deliveries; want 1", len(due))
+	}
+	assert.Equal(t, due[0].URL, webhook.URL)
+	assert.Equal(t, due[0].Secret, webhook.Secret)
+	assert.Equal(t, string(due[0].Payload), `{}`)
+
+	// A delivery is claimed once.
+	for _, want := range []bool{true, false} {
+		ok, err := webhooks.Claim(ctx, due[0], time.Now().Add(time.Minute))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, ok, want)
+	}
+
+	due[0].Status, due[0].Attempts, due[0].ResponseStatus = DeliverySucceeded, 1, 204
+	assert.Equal(t, webhooks.Finish(ctx, due[0]), nil)
+	assert.Equal(t, webhooks.Redeliver(ctx, webhook.ID, due[0].ID), nil)
+
+	deliveries, err := webhooks.Deliveries(ctx, webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("got %d deliveries; want 2", len(deliveries))
+	}
+	assert.Equal(t, deliveries[0].Status, DeliveryPending)
+	assert.Equal(t, deliveries[1].ResponseStatus, 204)
+
+	assert.Equal(t, webhooks.Delete(ctx, webhook.ID), nil)
+}